@@ -3,6 +3,7 @@ package anl
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
@@ -11,16 +12,21 @@ import (
 )
 
 type Analysis struct {
-	Name           string
-	ModelPath      string
-	ModelPathValid bool
-	ExecPath       string
-	ExecPathValid  bool
-	NumCPUs        int
-	Conditions     []Conditions
-	Viz            VizData
-	Model          *input.Model
-	Campbell       *CampbellData
+	Name                 string
+	ModelPath            string
+	ModelPathValid       bool
+	ExecPath             string
+	ExecPathValid        bool
+	NumCPUs              int
+	Conditions           []Conditions
+	ModeFilter           ModeFilter
+	ModalMethod          string      // ModalMethodMBC (default) or ModalMethodFloquet
+	PeriodicityThreshold float64     // Residual periodicity threshold, default if zero
+	Controller           *Controller // Controller for closed loop analysis, if not nil
+	SaveStepMatrices     bool        // Write matrices at each azimuth to the MAT-file
+	Viz                  VizData
+	Model                *input.Model
+	Campbell             *CampbellData
 }
 
 type Conditions struct {
@@ -34,7 +40,8 @@ type Conditions struct {
 
 func New() *Analysis {
 	return &Analysis{
-		NumCPUs: 1,
+		NumCPUs:     1,
+		ModalMethod: ModalMethodMBC,
 	}
 }
 
@@ -100,10 +107,29 @@ func (a *Analysis) ValidatePaths() {
 	}
 }
 
-type CampbellData struct {
+type VizData struct {
 }
 
-type VizData struct {
+// BuildCampbell reads the MBC results for each condition and assembles the
+// Campbell diagram data.
+func (a *Analysis) BuildCampbell() error {
+
+	mbcs := make([]*MBC, len(a.Conditions))
+	for i, c := range a.Conditions {
+		mbc, err := ReadMBC(NewTurbine(c, nil).MBCPath())
+		if err != nil {
+			return fmt.Errorf("error reading MBC results for condition %d: %w", c.ID, err)
+		}
+		mbcs[i] = mbc
+	}
+
+	campbell, err := NewCampbellData(a.Conditions, mbcs, a.ModeFilter)
+	if err != nil {
+		return err
+	}
+	a.Campbell = campbell
+
+	return nil
 }
 
 type EvalStatus struct {
@@ -147,6 +173,18 @@ func (a *Analysis) Evaluate(ctx context.Context, conditions Conditions,
 
 	// Create turbine from model and conditions
 	turbine := NewTurbine(conditions, model)
+	turbine.ModalMethod = a.ModalMethod
+	turbine.PeriodicityThreshold = a.PeriodicityThreshold
+	turbine.SaveStepMatrices = a.SaveStepMatrices
+
+	// Conditions are evaluated concurrently on up to NumCPUs, so the MBC of
+	// each condition uses one worker to avoid oversubscribing the CPUs
+	turbine.NumWorkers = 1
+	if a.Controller != nil {
+		if turbine.Controller, err = a.Controller.ForCondition(conditions, model); err != nil {
+			return err
+		}
+	}
 
 	// Create directory for turbine
 	if err := os.MkdirAll(filepath.Dir(turbine.ModelPath), 0777); err != nil {
@@ -158,5 +196,20 @@ func (a *Analysis) Evaluate(ctx context.Context, conditions Conditions,
 		return err
 	}
 
+	// Perform multi-blade coordinate transformation
+	statusChan <- EvalStatus{ID: turbine.ID, State: "MBC", Progress: 0}
+	if _, err := turbine.PerformMBC(); err != nil {
+		statusChan <- EvalStatus{
+			ID:       turbine.ID,
+			State:    "Error",
+			Progress: 100,
+			Error:    err.Error(),
+		}
+		return err
+	}
+
+	// Condition is complete once the MBC results have been written
+	statusChan <- EvalStatus{ID: turbine.ID, State: "Complete", Progress: 100}
+
 	return nil
 }
@@ -0,0 +1,222 @@
+package anl
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Linear model bundle format identifiers
+const (
+	BundleFormat      = "acdc-linear-model"
+	BundleVersion     = 1
+	BundleManifest    = "bundle.json"
+	BundleKindLinData = "lin" // Single linearization file in rotating frame
+	BundleKindMatData = "mbc" // Multi-blade coordinate transformed matrices
+)
+
+// Bundle is the manifest of a linear model bundle, a directory containing
+// the manifest file (BundleManifest) in JSON and one CSV file per matrix.
+// CSV files contain the matrix rows as comma separated values without a
+// header. Matrix file names in the manifest are relative to the bundle
+// directory and are empty if the matrix is not available.
+//
+// For linearization data (Kind "lin"), there is one step with the rotating
+// frame matrices in Raw and the channels are in linearization file order.
+// For matrix data (Kind "mbc"), there is one step per azimuth in ascending
+// order with the MBC matrices in Matrices and the rotating frame matrices in
+// Raw. Channels and MBC matrices are in MBC ordering while the raw channels
+// and matrices are in linearization file ordering.
+type Bundle struct {
+	Format      string
+	Version     int
+	Kind        string
+	NumBlades   int
+	NumStates   int
+	NumDOF2     int // Number of second order DOFs (states/2)
+	NumDOF1     int // Number of first order states
+	NumInputs   int
+	NumOutputs  int
+	States      []OperPointData
+	StateDerivs []OperPointData `json:",omitempty"`
+	Inputs      []OperPointData
+	Outputs     []OperPointData
+	RawStates   []OperPointData `json:",omitempty"`
+	RawInputs   []OperPointData `json:",omitempty"`
+	RawOutputs  []OperPointData `json:",omitempty"`
+	Steps       []BundleStep
+	Averaged    *BundleMatrices `json:",omitempty"`
+	AvgOpX      []float64       `json:",omitempty"`
+	AvgOpXd     []float64       `json:",omitempty"`
+}
+
+// BundleStep contains the data for one azimuth step of a bundle.
+type BundleStep struct {
+	Azimuth    float64         // Rotor azimuth (deg)
+	RotorSpeed float64         // Rotor speed (rad/s)
+	WindSpeed  float64         // Wind speed (m/s)
+	Matrices   *BundleMatrices `json:",omitempty"` // MBC matrices
+	Raw        *BundleMatrices // Rotating frame matrices
+	OpX        []float64       `json:",omitempty"` // MBC state operating point
+	OpXd       []float64       `json:",omitempty"` // MBC state derivative operating point
+}
+
+// BundleMatrices contains the names of the CSV files of the state-space
+// matrices.
+type BundleMatrices struct {
+	A, B, C, D string
+}
+
+// WriteBundle writes the linearization data as a linear model bundle in the
+// directory, which is created if it doesn't exist.
+func (ld *LinData) WriteBundle(dir string) error {
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	raw, err := writeBundleMatrices(dir, "", ld.A, ld.B, ld.C, ld.D)
+	if err != nil {
+		return err
+	}
+
+	b := &Bundle{
+		Format:      BundleFormat,
+		Version:     BundleVersion,
+		Kind:        BundleKindLinData,
+		NumStates:   ld.NumX,
+		NumDOF2:     ld.NumX2 / 2,
+		NumDOF1:     ld.NumX - ld.NumX2,
+		NumInputs:   ld.NumU,
+		NumOutputs:  ld.NumY,
+		States:      ld.X,
+		StateDerivs: ld.Xd,
+		Inputs:      ld.U,
+		Outputs:     ld.Y,
+		Steps: []BundleStep{{
+			Azimuth:    ld.Azimuth * 180 / math.Pi,
+			RotorSpeed: ld.RotorSpeed,
+			WindSpeed:  ld.WindSpeed,
+			Raw:        raw,
+		}},
+	}
+
+	return b.write(dir)
+}
+
+// WriteBundle writes the matrix data as a linear model bundle in the
+// directory, which is created if it doesn't exist.
+func (md *MatData) WriteBundle(dir string) error {
+
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+
+	b := &Bundle{
+		Format:     BundleFormat,
+		Version:    BundleVersion,
+		Kind:       BundleKindMatData,
+		NumBlades:  md.NumBlades,
+		NumStates:  md.NumStates,
+		NumDOF2:    md.NumDOF2,
+		NumDOF1:    md.NumDOF1,
+		NumInputs:  md.NumInputs,
+		NumOutputs: md.NumOutputs,
+		States:     md.DescStates,
+		Inputs:     md.DescInputs,
+		Outputs:    md.DescOutputs,
+		Steps:      make([]BundleStep, md.NumStep),
+		AvgOpX:     vecToSlice(md.AvgOpX),
+		AvgOpXd:    vecToSlice(md.AvgOpXd),
+	}
+
+	at := func(ms []*mat.Dense, i int) *mat.Dense {
+		if ms == nil {
+			return nil
+		}
+		return ms[i]
+	}
+	atVec := func(vs []*mat.VecDense, i int) []float64 {
+		if i >= len(vs) {
+			return nil
+		}
+		return vecToSlice(vs[i])
+	}
+
+	var err error
+	for i := range b.Steps {
+		step := &b.Steps[i]
+		step.Azimuth = md.Azimuth.AtVec(i)
+		step.RotorSpeed = md.Omega.AtVec(i)
+		step.WindSpeed = md.WindSpeed.AtVec(i)
+		step.OpX = atVec(md.OpX, i)
+		step.OpXd = atVec(md.OpXd, i)
+		suffix := fmt.Sprintf("_%02d", i+1)
+		step.Matrices, err = writeBundleMatrices(dir, "",
+			at(md.A, i), at(md.B, i), at(md.C, i), at(md.D, i), suffix)
+		if err != nil {
+			return err
+		}
+		if i < len(md.LinData) {
+			ld := md.LinData[i]
+			if step.Raw, err = writeBundleMatrices(dir, "Raw", ld.A, ld.B, ld.C, ld.D, suffix); err != nil {
+				return err
+			}
+		}
+	}
+
+	if b.Averaged, err = writeBundleMatrices(dir, "Avg", md.AvgA, md.AvgB, md.AvgC, md.AvgD); err != nil {
+		return err
+	}
+
+	if len(md.LinData) > 0 {
+		b.RawStates = md.LinData[0].X
+		b.RawInputs = md.LinData[0].U
+		b.RawOutputs = md.LinData[0].Y
+	}
+
+	return b.write(dir)
+}
+
+// write saves the manifest in the bundle directory.
+func (b *Bundle) write(dir string) error {
+	bs, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, BundleManifest), bs, 0777)
+}
+
+// writeBundleMatrices writes the non-nil matrices to CSV files named with the
+// prefix, the matrix name, and the optional suffix, and returns the names.
+func writeBundleMatrices(dir, prefix string, A, B, C, D *mat.Dense, suffix ...string) (*BundleMatrices, error) {
+	bm := &BundleMatrices{}
+	for _, m := range []struct {
+		name   string
+		matrix *mat.Dense
+		file   *string
+	}{
+		{"A", A, &bm.A},
+		{"B", B, &bm.B},
+		{"C", C, &bm.C},
+		{"D", D, &bm.D},
+	} {
+		if m.matrix == nil {
+			continue
+		}
+		name := prefix + m.name
+		for _, s := range suffix {
+			name += s
+		}
+		name += ".csv"
+		if err := toCSV(m.matrix, filepath.Join(dir, name)); err != nil {
+			return nil, err
+		}
+		*m.file = name
+	}
+	return bm, nil
+}
@@ -0,0 +1,141 @@
+package anl_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+// readBundle reads the manifest of the bundle in the directory.
+func readBundle(t *testing.T, dir string) *anl.Bundle {
+	t.Helper()
+	bs, err := os.ReadFile(filepath.Join(dir, anl.BundleManifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &anl.Bundle{}
+	if err := json.Unmarshal(bs, b); err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// readCSVMatrix reads the rows of a bundle matrix file.
+func readCSVMatrix(t *testing.T, path string) [][]float64 {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]float64{}
+	for _, line := range strings.Split(strings.TrimSpace(string(bs)), "\n") {
+		row := []float64{}
+		for _, field := range strings.Split(line, ",") {
+			v, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			row = append(row, v)
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestLinDataWriteBundle(t *testing.T) {
+
+	ld := newDrivetrainLinData(0.1, -0.2, -0.01)[0]
+	dir := filepath.Join(t.TempDir(), "lin")
+	if err := ld.WriteBundle(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b := readBundle(t, dir)
+	if b.Format != anl.BundleFormat || b.Kind != anl.BundleKindLinData {
+		t.Errorf("Format = %s, Kind = %s", b.Format, b.Kind)
+	}
+	if len(b.Steps) != 1 || b.Steps[0].Raw == nil || b.Steps[0].Raw.B != "B.csv" {
+		t.Fatalf("Steps = %+v, expected one step with B.csv", b.Steps)
+	}
+	if len(b.Inputs) != 4 || b.Inputs[3].Desc != ld.U[3].Desc {
+		t.Errorf("Inputs = %v", b.Inputs)
+	}
+
+	B := readCSVMatrix(t, filepath.Join(dir, b.Steps[0].Raw.B))
+	if len(B) != 2 || len(B[1]) != 4 || B[1][0] != ld.B.At(1, 0) || B[1][3] != ld.B.At(1, 3) {
+		t.Errorf("B = %v", B)
+	}
+}
+
+func TestMatDataWriteBundle(t *testing.T) {
+
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := md.WriteBundle(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	b := readBundle(t, dir)
+	if b.Kind != anl.BundleKindMatData || b.NumBlades != 3 {
+		t.Errorf("Kind = %s, NumBlades = %d", b.Kind, b.NumBlades)
+	}
+	if len(b.Steps) != md.NumStep {
+		t.Fatalf("%d steps, expected %d", len(b.Steps), md.NumStep)
+	}
+	for i, step := range b.Steps {
+		if step.Azimuth != md.Azimuth.AtVec(i) {
+			t.Errorf("step %d azimuth = %v, expected %v", i, step.Azimuth, md.Azimuth.AtVec(i))
+		}
+		if step.Matrices == nil || step.Raw == nil || step.Matrices.A == "" || step.Raw.A == "" {
+			t.Errorf("step %d matrices = %+v, raw = %+v", i, step.Matrices, step.Raw)
+		}
+	}
+	if b.Steps[1].Matrices.B != "B_02.csv" || b.Steps[1].Raw.B != "RawB_02.csv" {
+		t.Errorf("step 2 files = %s, %s", b.Steps[1].Matrices.B, b.Steps[1].Raw.B)
+	}
+	if len(b.RawInputs) != 4 || len(b.Inputs) != md.NumInputs {
+		t.Errorf("%d raw inputs, %d inputs", len(b.RawInputs), len(b.Inputs))
+	}
+
+	if b.Averaged == nil || b.Averaged.B != "AvgB.csv" {
+		t.Fatalf("Averaged = %+v", b.Averaged)
+	}
+	AvgB := readCSVMatrix(t, filepath.Join(dir, b.Averaged.B))
+	r, c := md.AvgB.Dims()
+	if len(AvgB) != r || len(AvgB[0]) != c {
+		t.Fatalf("AvgB is %dx%d, expected %dx%d", len(AvgB), len(AvgB[0]), r, c)
+	}
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			if AvgB[i][j] != md.AvgB.At(i, j) {
+				t.Errorf("AvgB(%d,%d) = %v, expected %v", i, j, AvgB[i][j], md.AvgB.At(i, j))
+			}
+		}
+	}
+}
+
+func TestMatDataWriteBundleWithoutOperatingPoints(t *testing.T) {
+
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	md.OpX, md.OpXd, md.AvgOpX, md.AvgOpXd = nil, nil, nil, nil
+	dir := t.TempDir()
+	if err := md.WriteBundle(dir); err != nil {
+		t.Fatal(err)
+	}
+	for i, step := range readBundle(t, dir).Steps {
+		if step.OpX != nil || step.OpXd != nil {
+			t.Errorf("step %d OpX = %v, OpXd = %v, expected nil", i, step.OpX, step.OpXd)
+		}
+	}
+}
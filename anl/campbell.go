@@ -0,0 +1,234 @@
+package anl
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CampbellData contains the frequency and damping of each mode versus
+// operating condition and the rotor harmonic excitation frequencies.
+type CampbellData struct {
+	RotorSpeed []float64 // Rotor speed of each condition (rpm)
+	WindSpeed  []float64 // Wind speed of each condition (m/s)
+	Modes      []CampbellMode
+	Harmonics  []RotorHarmonic
+
+	// Closed loop modes, if closed loop analysis was performed
+	ClosedLoopModes []CampbellMode
+}
+
+// CampbellMode contains the results for a mode at each condition where it
+// was found.
+type CampbellMode struct {
+	ID     int
+	Name   string // Most common name of the mode across conditions
+	Points []CampbellPoint
+	names  []string
+}
+
+func (cm *CampbellMode) meanNaturalFreqHz() float64 {
+	sum := 0.0
+	for _, p := range cm.Points {
+		sum += p.NaturalFreqHz
+	}
+	return sum / float64(len(cm.Points))
+}
+
+type CampbellPoint struct {
+	ConditionID   int
+	ModeIndex     int     // Index of mode in the condition's MBC results
+	MAC           float64 // MAC with the mode at the previous condition, zero at the first
+	RotorSpeed    float64 // Rotor speed (rpm)
+	WindSpeed     float64 // Wind speed (m/s)
+	NaturalFreqHz float64 // Natural frequency (Hz)
+	DampedFreqHz  float64 // Damped frequency (Hz)
+	DampingRatio  float64 // Damping ratio (-)
+	Periodic      bool    // Residual periodicity flagged at condition
+}
+
+// RotorHarmonic is an excitation line at a multiple of the rotor speed.
+type RotorHarmonic struct {
+	Multiple int       // Multiple of rotor speed, 3 for 3P
+	FreqHz   []float64 // Frequency at each condition (Hz)
+}
+
+// ModeFilter selects the modes included in the Campbell diagram data so
+// spurious modes don't clutter the diagram. The zero value includes all
+// oscillatory and unstable modes.
+type ModeFilter struct {
+	MaxNaturalFreqHz  float64 // Exclude modes above this frequency (Hz), no limit if zero
+	MaxDampingRatio   float64 // Exclude modes with damping ratio above this value, no limit if zero
+	IncludeOverdamped bool    // Include modes with real, negative eigenvalues
+	IncludeRigidBody  bool    // Include modes with zero eigenvalues
+}
+
+// Include returns true if the mode passes the filter.
+func (f ModeFilter) Include(m *ModeResults) bool {
+	switch {
+	case m.Type == ModeOverdamped && !f.IncludeOverdamped:
+		return false
+	case m.Type == ModeRigidBody && !f.IncludeRigidBody:
+		return false
+	case f.MaxNaturalFreqHz > 0 && m.NaturalFreqHz > f.MaxNaturalFreqHz:
+		return false
+	case f.MaxDampingRatio > 0 && m.DampingRatio > f.MaxDampingRatio:
+		return false
+	}
+	return true
+}
+
+// NewCampbellData assembles the Campbell diagram data from the MBC results
+// for each condition. Modes which don't pass the filter are excluded and the
+// remaining modes are tracked across conditions so each Campbell mode has a
+// persistent identity through the sweep. Floquet modes are used for conditions
+// where Floquet analysis was performed. Closed loop modes are tracked
+// separately when closed loop analysis was performed.
+func NewCampbellData(conditions []Conditions, mbcs []*MBC, filter ModeFilter) (*CampbellData, error) {
+
+	if len(conditions) != len(mbcs) {
+		return nil, fmt.Errorf("number of conditions (%d) doesn't match number of MBC results (%d)",
+			len(conditions), len(mbcs))
+	}
+
+	cd := &CampbellData{
+		RotorSpeed: make([]float64, len(mbcs)),
+		WindSpeed:  make([]float64, len(mbcs)),
+	}
+
+	// Get condition parameters
+	numBlades := 0
+	for i, mbc := range mbcs {
+		cd.RotorSpeed[i] = mbc.RotSpeed
+		cd.WindSpeed[i] = mbc.WindSpeed
+		if mbc.NumBlades > numBlades {
+			numBlades = mbc.NumBlades
+		}
+	}
+
+	// Track open loop modes, using Floquet modes where available
+	cd.Modes = campbellModes(conditions, mbcs, filter, func(mbc *MBC) []*ModeResults {
+		if mbc.Floquet != nil {
+			return mbc.Floquet.Modes
+		}
+		return mbc.Modes
+	})
+
+	// Track closed loop modes if closed loop analysis was performed
+	for _, mbc := range mbcs {
+		if mbc.ClosedLoop != nil {
+			cd.ClosedLoopModes = campbellModes(conditions, mbcs, filter, func(mbc *MBC) []*ModeResults {
+				if mbc.ClosedLoop == nil {
+					return nil
+				}
+				return mbc.ClosedLoop.Modes
+			})
+			break
+		}
+	}
+
+	// Add rotor harmonic excitation lines
+	for _, m := range harmonicMultiples(numBlades) {
+		h := RotorHarmonic{Multiple: m, FreqHz: make([]float64, len(mbcs))}
+		for i, rs := range cd.RotorSpeed {
+			h.FreqHz[i] = float64(m) * rs / 60
+		}
+		cd.Harmonics = append(cd.Harmonics, h)
+	}
+
+	return cd, nil
+}
+
+// campbellModes tracks the modes returned by modeResults for each condition
+// and returns them as Campbell modes sorted by mean natural frequency.
+func campbellModes(conditions []Conditions, mbcs []*MBC, filter ModeFilter,
+	modeResults func(*MBC) []*ModeResults) []CampbellMode {
+
+	// Filter modes at each condition
+	modeSets := make([][]*ModeResults, len(mbcs))
+	modeIndexes := make([][]int, len(mbcs))
+	for i, mbc := range mbcs {
+		for j, mode := range modeResults(mbc) {
+			if filter.Include(mode) {
+				modeSets[i] = append(modeSets[i], mode)
+				modeIndexes[i] = append(modeIndexes[i], j)
+			}
+		}
+	}
+
+	// Track modes across conditions
+	trackIDs, macs := trackModes(modeSets)
+
+	// Add mode results to Campbell modes
+	var cms []CampbellMode
+	for i, modes := range modeSets {
+		for j, mode := range modes {
+			id := trackIDs[i][j]
+			for id >= len(cms) {
+				cms = append(cms, CampbellMode{})
+			}
+			cms[id].Points = append(cms[id].Points, CampbellPoint{
+				ConditionID:   conditions[i].ID,
+				ModeIndex:     modeIndexes[i][j],
+				MAC:           macs[i][j],
+				RotorSpeed:    mbcs[i].RotSpeed,
+				WindSpeed:     mbcs[i].WindSpeed,
+				NaturalFreqHz: mode.NaturalFreqHz,
+				DampedFreqHz:  mode.DampedFreqHz,
+				DampingRatio:  mode.DampingRatio,
+				Periodic:      mbcs[i].Periodicity != nil && mbcs[i].Periodicity.Flagged,
+			})
+		}
+	}
+
+	// Name modes from their names at each condition
+	for i, modes := range modeSets {
+		for j, mode := range modes {
+			cms[trackIDs[i][j]].names = append(cms[trackIDs[i][j]].names, mode.Name)
+		}
+	}
+	for i := range cms {
+		cms[i].Name = mostCommon(cms[i].names)
+	}
+
+	// Sort modes by mean natural frequency and assign identifiers
+	sort.SliceStable(cms, func(i, j int) bool {
+		return cms[i].meanNaturalFreqHz() < cms[j].meanNaturalFreqHz()
+	})
+	for i := range cms {
+		cms[i].ID = i + 1
+	}
+
+	return cms
+}
+
+// harmonicMultiples returns the rotor speed multiples of the excitation
+// lines: 1P and the first three multiples of the blade passing frequency.
+func harmonicMultiples(numBlades int) []int {
+	if numBlades < 1 {
+		numBlades = 1
+	}
+	multiples := []int{1}
+	for k := 1; k <= 3; k++ {
+		if m := k * numBlades; m != multiples[len(multiples)-1] {
+			multiples = append(multiples, m)
+		}
+	}
+	return multiples
+}
+
+// mostCommon returns the most common non-empty string in the slice, with
+// ties going to the string which appears first.
+func mostCommon(ss []string) string {
+	counts := map[string]int{}
+	best := ""
+	for _, s := range ss {
+		if s == "" {
+			continue
+		}
+		counts[s]++
+		if counts[s] > counts[best] {
+			best = s
+		}
+	}
+	return best
+}
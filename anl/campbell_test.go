@@ -0,0 +1,84 @@
+package anl_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestNewCampbellData(t *testing.T) {
+
+	conditions := []anl.Conditions{
+		{ID: 1, WindSpeed: 10, RotorSpeed: 10},
+		{ID: 2, WindSpeed: 12, RotorSpeed: 20},
+	}
+
+	mbcs := make([]*anl.MBC, len(conditions))
+	for i, c := range conditions {
+		ts := newTestSystem(3, c.RotorSpeed*math.Pi/30, []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2})
+		md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mbcs[i] = anl.NewMBC(md)
+	}
+
+	cd, err := anl.NewCampbellData(conditions, mbcs, anl.ModeFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cd.Modes) != len(mbcs[0].Modes) {
+		t.Fatalf("len(Modes) = %d, expected %d", len(cd.Modes), len(mbcs[0].Modes))
+	}
+	for _, mode := range cd.Modes {
+		if len(mode.Points) != len(conditions) {
+			t.Fatalf("mode %d has %d points, expected %d", mode.ID, len(mode.Points), len(conditions))
+		}
+	}
+	for i := 1; i < len(cd.Modes); i++ {
+		if cd.Modes[i].Points[0].NaturalFreqHz < cd.Modes[i-1].Points[0].NaturalFreqHz {
+			t.Fatalf("modes not sorted by natural frequency")
+		}
+	}
+
+	expMultiples := []int{1, 3, 6, 9}
+	if len(cd.Harmonics) != len(expMultiples) {
+		t.Fatalf("len(Harmonics) = %d, expected %d", len(cd.Harmonics), len(expMultiples))
+	}
+	for i, h := range cd.Harmonics {
+		if h.Multiple != expMultiples[i] {
+			t.Fatalf("Harmonics[%d].Multiple = %d, expected %d", i, h.Multiple, expMultiples[i])
+		}
+		exp := float64(h.Multiple) * conditions[1].RotorSpeed / 60
+		if math.Abs(h.FreqHz[1]-exp) > 1e-12 {
+			t.Fatalf("Harmonics[%d].FreqHz[1] = %v, expected %v", i, h.FreqHz[1], exp)
+		}
+	}
+}
+
+func TestModeFilter(t *testing.T) {
+
+	testCases := []struct {
+		filter anl.ModeFilter
+		mode   anl.ModeResults
+		exp    bool
+	}{
+		{anl.ModeFilter{}, anl.ModeResults{Type: anl.ModeOscillatory}, true},
+		{anl.ModeFilter{}, anl.ModeResults{Type: anl.ModeUnstable}, true},
+		{anl.ModeFilter{}, anl.ModeResults{Type: anl.ModeOverdamped}, false},
+		{anl.ModeFilter{}, anl.ModeResults{Type: anl.ModeRigidBody}, false},
+		{anl.ModeFilter{IncludeOverdamped: true}, anl.ModeResults{Type: anl.ModeOverdamped}, true},
+		{anl.ModeFilter{IncludeRigidBody: true}, anl.ModeResults{Type: anl.ModeRigidBody}, true},
+		{anl.ModeFilter{MaxNaturalFreqHz: 2}, anl.ModeResults{Type: anl.ModeOscillatory, NaturalFreqHz: 3}, false},
+		{anl.ModeFilter{MaxDampingRatio: 0.5}, anl.ModeResults{Type: anl.ModeOscillatory, DampingRatio: 0.6}, false},
+		{anl.ModeFilter{MaxDampingRatio: 0.5}, anl.ModeResults{Type: anl.ModeOscillatory, DampingRatio: 0.4}, true},
+	}
+
+	for i, tc := range testCases {
+		if act := tc.filter.Include(&tc.mode); act != tc.exp {
+			t.Errorf("case %d: Include = %v, expected %v", i, act, tc.exp)
+		}
+	}
+}
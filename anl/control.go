@@ -0,0 +1,221 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/deslaughter/acdc/input"
+	"gonum.org/v1/gonum/mat"
+)
+
+// Default channel names used to connect the controller to the MBC
+// state-space model. Names are matched as in MBC.FrequencyResponse. The
+// default speed state is the ElastoDyn generator azimuth velocity.
+const (
+	DefaultPitchInput  = "Blade collective pitch command"
+	DefaultTorqueInput = "ED Generator torque"
+)
+
+// Controller defines a linear PI collective pitch controller and a
+// proportional generator torque controller acting on the perturbation in
+// generator speed. The loop is closed on the azimuth averaged MBC state-space
+// model. Gains act on the high speed shaft generator speed, so positive gains
+// increase pitch and torque as speed increases.
+type Controller struct {
+	PitchKp            float64           // Pitch proportional gain (rad/(rad/s))
+	PitchKi            float64           // Pitch integral gain (rad/rad)
+	TorqueGain         float64           // Torque proportional gain (N-m/(rad/s))
+	TorqueFromServoDyn bool              // Torque gain from ServoDyn simple variable speed control
+	GearboxRatio       float64           // Generator to rotor speed ratio, from ElastoDyn if zero
+	PitchInput         string            // Pitch input name, DefaultPitchInput if empty
+	TorqueInput        string            // Torque input name, DefaultTorqueInput if empty
+	SpeedState         string            // Rotor speed state name, generator azimuth velocity if empty
+	Schedule           []ControllerGains // Gains for specific conditions
+}
+
+// ControllerGains are the controller gains for a condition.
+type ControllerGains struct {
+	ConditionID int
+	PitchKp     float64 // Pitch proportional gain (rad/(rad/s))
+	PitchKi     float64 // Pitch integral gain (rad/rad)
+	TorqueGain  float64 // Torque proportional gain (N-m/(rad/s))
+}
+
+// ClosedLoopResults contains the eigenanalysis results of the azimuth
+// averaged MBC state-space model with the controller loop closed. If the pitch
+// controller has integral gain, the integrator state is appended to the
+// states, but it isn't included in the mode eigenvectors.
+type ClosedLoopResults struct {
+	PitchKp      float64
+	PitchKi      float64
+	TorqueGain   float64
+	GearboxRatio float64
+	Modes        []*ModeResults
+}
+
+// ForCondition returns a copy of the controller with the gains for the
+// condition. Gains in the schedule for the condition override the controller
+// gains. If TorqueFromServoDyn is set, the torque gain is computed from the
+// ServoDyn simple variable speed controller at the condition's rotor speed.
+// If the gearbox ratio is zero, it is taken from ElastoDyn.
+func (c *Controller) ForCondition(cond Conditions, model *input.Model) (*Controller, error) {
+
+	cc := *c
+	cc.Schedule = nil
+
+	// Gearbox ratio from ElastoDyn
+	if cc.GearboxRatio == 0 {
+		if model == nil || model.ElastoDyn == nil {
+			return nil, fmt.Errorf("gearbox ratio not specified and ElastoDyn not available")
+		}
+		cc.GearboxRatio = model.ElastoDyn.GBRatio
+	}
+
+	// Torque gain from ServoDyn
+	if cc.TorqueFromServoDyn {
+		if model == nil || model.ServoDyn == nil {
+			return nil, fmt.Errorf("torque gain from ServoDyn requested but ServoDyn not available")
+		}
+		var err error
+		cc.TorqueGain, err = servoDynTorqueGain(model.ServoDyn, cond.RotorSpeed*cc.GearboxRatio)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Scheduled gains for the condition
+	for _, g := range c.Schedule {
+		if g.ConditionID == cond.ID {
+			cc.PitchKp, cc.PitchKi, cc.TorqueGain = g.PitchKp, g.PitchKi, g.TorqueGain
+			break
+		}
+	}
+
+	return &cc, nil
+}
+
+// servoDynTorqueGain returns the derivative of generator torque with respect
+// to generator speed (N-m/(rad/s)) of the ServoDyn simple variable speed
+// controller at the generator speed (rpm). Torque is quadratic in speed in
+// region 2, linear in region 2 1/2, and constant in region 3.
+func servoDynTorqueGain(sd *input.ServoDyn, genSpeed float64) (float64, error) {
+
+	if sd.VSContrl != 1 {
+		return 0, fmt.Errorf("ServoDyn VSContrl = %d, simple variable speed control (1) required", sd.VSContrl)
+	}
+
+	// Synchronous speed and slope of region 2 1/2
+	sySp := sd.VS_RtGnSp / (1 + 0.01*sd.VS_SlPc)
+	slope := sd.VS_RtTq / (sd.VS_RtGnSp - sySp)
+
+	// Transition speed between region 2 and region 2 1/2
+	trGnSp := sySp
+	if sd.VS_Rgn2K > 0 {
+		trGnSp = (slope - math.Sqrt(slope*(slope-4*sd.VS_Rgn2K*sySp))) / (2 * sd.VS_Rgn2K)
+	}
+
+	// Derivative of torque (N-m/rpm)
+	var dTdw float64
+	switch {
+	case genSpeed >= sd.VS_RtGnSp:
+		dTdw = 0
+	case genSpeed >= trGnSp:
+		dTdw = slope
+	default:
+		dTdw = 2 * sd.VS_Rgn2K * genSpeed
+	}
+
+	// Convert to N-m/(rad/s)
+	return dTdw * 30 / math.Pi, nil
+}
+
+// speedStateIndex returns the index of the ElastoDyn generator azimuth
+// velocity state, found from the parsed descriptions as in
+// operPointAccelerations.
+func speedStateIndex(desc []OperPointData) (int, error) {
+	for i, op := range desc {
+		cd := ParseDesc(op.Desc)
+		if cd.Module == "ED" && cd.DOF == "DOF_GeAz" && cd.Deriv == 1 {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("no ED generator azimuth velocity (DOF_GeAz) state")
+}
+
+// closedLoopAnalysis closes the controller loop on the azimuth averaged MBC
+// state-space model and computes the closed loop modes. With speed
+// perturbation w = G*c*x, where G is the gearbox ratio and c selects the
+// rotor speed state, the pitch is Kp*w + Ki*z, with z' = w, and the torque is
+// Kt*w.
+func closedLoopAnalysis(md *MatData, c *Controller) (*ClosedLoopResults, error) {
+
+	if md.AvgB == nil {
+		return nil, fmt.Errorf("closed loop analysis requires input matrices")
+	}
+
+	// Find controller channels
+	descInputs, descStates := descriptions(md.DescInputs), descriptions(md.DescStates)
+	pitchInput, torqueInput := DefaultPitchInput, DefaultTorqueInput
+	if c.PitchInput != "" {
+		pitchInput = c.PitchInput
+	}
+	if c.TorqueInput != "" {
+		torqueInput = c.TorqueInput
+	}
+	ip, err := findChannel(descInputs, pitchInput)
+	if err != nil && (c.PitchKp != 0 || c.PitchKi != 0) {
+		return nil, fmt.Errorf("pitch input: %w", err)
+	}
+	it, err := findChannel(descInputs, torqueInput)
+	if err != nil && c.TorqueGain != 0 {
+		return nil, fmt.Errorf("torque input: %w", err)
+	}
+	is, err := speedStateIndex(md.DescStates)
+	if c.SpeedState != "" {
+		is, err = findChannel(descStates, c.SpeedState)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("speed state: %w", err)
+	}
+
+	// Feedback from speed state to state derivatives
+	n := md.NumStates
+	feedback := mat.NewVecDense(n, nil)
+	if c.PitchKp != 0 {
+		feedback.AddScaledVec(feedback, c.PitchKp*c.GearboxRatio, md.AvgB.ColView(ip))
+	}
+	if c.TorqueGain != 0 {
+		feedback.AddScaledVec(feedback, c.TorqueGain*c.GearboxRatio, md.AvgB.ColView(it))
+	}
+
+	// Closed loop state matrix, with integrator state if integral gain
+	nc := n
+	if c.PitchKi != 0 {
+		nc++
+	}
+	A := mat.NewDense(nc, nc, nil)
+	A.Slice(0, n, 0, n).(*mat.Dense).Copy(md.AvgA)
+	for i := 0; i < n; i++ {
+		A.Set(i, is, A.At(i, is)+feedback.AtVec(i))
+	}
+	if c.PitchKi != 0 {
+		for i := 0; i < n; i++ {
+			A.Set(i, n, c.PitchKi*md.AvgB.At(i, ip))
+		}
+		A.Set(n, is, c.GearboxRatio)
+	}
+
+	cl := &ClosedLoopResults{
+		PitchKp:      c.PitchKp,
+		PitchKi:      c.PitchKi,
+		TorqueGain:   c.TorqueGain,
+		GearboxRatio: c.GearboxRatio,
+	}
+
+	// Eigenanalysis of closed loop state matrix
+	if cl.Modes, err = modesFromEigen(md, A, modeRows(md)); err != nil {
+		return nil, fmt.Errorf("closed loop: %w", err)
+	}
+
+	return cl, nil
+}
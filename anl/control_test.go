@@ -0,0 +1,171 @@
+package anl_test
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"github.com/deslaughter/acdc/input"
+	"gonum.org/v1/gonum/mat"
+)
+
+// newDrivetrainLinData returns linearization data for a rigid drivetrain with
+// rotor speed damping d and individual blade pitch and generator torque
+// inputs with the given effect on rotor acceleration, and a rotor speed
+// output.
+func newDrivetrainLinData(d, pitchEffect, torqueEffect float64) []*anl.LinData {
+	linData := make([]*anl.LinData, 4)
+	for i := range linData {
+		linData[i] = &anl.LinData{
+			Azimuth:    math.Pi / 2 * float64(i),
+			RotorSpeed: 1,
+			NumX:       2,
+			NumX2:      2,
+			NumU:       4,
+			NumY:       1,
+			X: []anl.OperPointData{
+				{RC: 1, DerivOrder: 2, Desc: "ED Variable speed generator DOF (internal DOF index = DOF_GeAz), rad"},
+				{RC: 2, DerivOrder: 2, Desc: "ED First time derivative of Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s"},
+			},
+			U: []anl.OperPointData{
+				{RC: 1, IsRotating: true, Desc: "ED Blade 1 pitch command, rad"},
+				{RC: 2, IsRotating: true, Desc: "ED Blade 2 pitch command, rad"},
+				{RC: 3, IsRotating: true, Desc: "ED Blade 3 pitch command, rad"},
+				{RC: 4, Desc: "ED Generator torque, Nm"},
+			},
+			Y: []anl.OperPointData{
+				{RC: 1, Desc: "ED RotSpeed, (rpm)"},
+			},
+			A: mat.NewDense(2, 2, []float64{0, 1, 0, -d}),
+			B: mat.NewDense(2, 4, []float64{
+				0, 0, 0, 0,
+				pitchEffect, pitchEffect, pitchEffect, torqueEffect,
+			}),
+			C: mat.NewDense(1, 2, []float64{0, 30 / math.Pi}),
+			D: mat.NewDense(1, 4, nil),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	return linData
+}
+
+func TestClosedLoopAnalysis(t *testing.T) {
+
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &anl.Controller{PitchKp: 0.01, PitchKi: 0.002, TorqueGain: 0.05, GearboxRatio: 97}
+	cl, err := anl.ClosedLoopAnalysis(md, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Speed and integrator dynamics, s^2 + a*s + b = 0, with collective
+	// pitch effect three times the individual blade effect
+	a := 0.1 + 0.6*c.PitchKp*97 + 0.01*c.TorqueGain*97
+	b := 0.6 * c.PitchKi * 97
+	disc := cmplx.Sqrt(complex(a*a-4*b, 0))
+	exp := []complex128{0, (complex(-a, 0) - disc) / 2, (complex(-a, 0) + disc) / 2}
+
+	if len(cl.Modes) != len(exp) {
+		t.Fatalf("got %d closed loop modes, expected %d", len(cl.Modes), len(exp))
+	}
+	for _, ev := range exp {
+		found := false
+		for _, mode := range cl.Modes {
+			if cmplx.Abs(mode.EigenValue-ev) < 1e-10 {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("closed loop eigenvalue %v not found", ev)
+		}
+	}
+	if len(cl.Modes[0].EigenVector) != md.NumDOF2+md.NumDOF1 {
+		t.Fatalf("closed loop eigenvector has %d rows, expected %d", len(cl.Modes[0].EigenVector), md.NumDOF2+md.NumDOF1)
+	}
+
+	// Closed loop modes are tracked in the Campbell data
+	md.ClosedLoop = cl
+	mbc := anl.NewMBC(md)
+	cd, err := anl.NewCampbellData([]anl.Conditions{{ID: 1}, {ID: 2}}, []*anl.MBC{mbc, mbc},
+		anl.ModeFilter{IncludeOverdamped: true, IncludeRigidBody: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cd.ClosedLoopModes) != len(cl.Modes) {
+		t.Fatalf("got %d closed loop Campbell modes, expected %d", len(cd.ClosedLoopModes), len(cl.Modes))
+	}
+	for _, cm := range cd.ClosedLoopModes {
+		if len(cm.Points) != 2 {
+			t.Errorf("closed loop mode %d has %d points, expected 2", cm.ID, len(cm.Points))
+		}
+	}
+
+	// Missing channel
+	if _, err := anl.ClosedLoopAnalysis(md, &anl.Controller{PitchKp: 1, PitchInput: "yaw", GearboxRatio: 1}); err == nil {
+		t.Fatal("expected error for missing pitch input")
+	}
+}
+
+func TestControllerForCondition(t *testing.T) {
+
+	model := &input.Model{
+		ElastoDyn: &input.ElastoDyn{GBRatio: 97},
+		ServoDyn: &input.ServoDyn{
+			VSContrl:  1,
+			VS_RtGnSp: 1173.7,
+			VS_RtTq:   43093.55,
+			VS_Rgn2K:  0.0255764,
+			VS_SlPc:   10,
+		},
+	}
+	c := &anl.Controller{
+		PitchKp:            0.01,
+		TorqueFromServoDyn: true,
+		Schedule:           []anl.ControllerGains{{ConditionID: 4, PitchKp: 0.02, PitchKi: 0.003, TorqueGain: 7}},
+	}
+
+	testCases := []struct {
+		cond       anl.Conditions
+		pitchKp    float64
+		torqueGain float64
+	}{
+		// Region 2, quadratic torque
+		{anl.Conditions{ID: 1, RotorSpeed: 8}, 0.01, 2 * 0.0255764 * 8 * 97 * 30 / math.Pi},
+		// Region 2 1/2, linear torque
+		{anl.Conditions{ID: 2, RotorSpeed: 12}, 0.01, 43093.55 / (1173.7 - 1067) * 30 / math.Pi},
+		// Region 3, constant torque
+		{anl.Conditions{ID: 3, RotorSpeed: 12.1}, 0.01, 0},
+		// Scheduled gains
+		{anl.Conditions{ID: 4, RotorSpeed: 12.1}, 0.02, 7},
+	}
+
+	for _, tc := range testCases {
+		cc, err := c.ForCondition(tc.cond, model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cc.GearboxRatio != 97 {
+			t.Errorf("condition %d: GearboxRatio = %v, expected 97", tc.cond.ID, cc.GearboxRatio)
+		}
+		if cc.PitchKp != tc.pitchKp {
+			t.Errorf("condition %d: PitchKp = %v, expected %v", tc.cond.ID, cc.PitchKp, tc.pitchKp)
+		}
+		if math.Abs(cc.TorqueGain-tc.torqueGain) > 1e-6*math.Abs(tc.torqueGain)+1e-12 {
+			t.Errorf("condition %d: TorqueGain = %v, expected %v", tc.cond.ID, cc.TorqueGain, tc.torqueGain)
+		}
+		if cc.Schedule != nil {
+			t.Errorf("condition %d: Schedule not cleared", tc.cond.ID)
+		}
+	}
+
+	// ServoDyn simple variable speed control required
+	model.ServoDyn.VSContrl = 5
+	if _, err := c.ForCondition(testCases[0].cond, model); err == nil {
+		t.Fatal("expected error for VSContrl != 1")
+	}
+}
@@ -0,0 +1,174 @@
+package anl
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ChannelDesc is the structured form of a state, input, or output description
+// from a linearization file, e.g. "ED 1st flapwise bending-mode DOF of blade 1
+// (internal DOF index = DOF_BF(1,1)), m" is module ED, blade 1, quantity
+// "1st flapwise bending-mode DOF", DOF "DOF_BF(1,1)", and unit "m".
+type ChannelDesc struct {
+	Module   string // Source module abbreviation (ED, BD, AD, SrvD, IfW, ...)
+	Instance int    // Module instance number (e.g. 2 for BD_2), 0 if none
+	Blade    int    // Blade number, 0 if not blade specific
+	Coord    string // MBC coordinate (collective, cosine, etc.) replacing the blade number
+	Node     int    // Node number, 0 if not node specific
+	Deriv    int    // Order of time derivative (First time derivative of ...)
+	Quantity string // Physical quantity without module, blade, node, DOF, and unit
+	DOF      string // Internal DOF name (e.g. DOF_TFA1)
+	Unit     string // Unit without parenthesis (e.g. m/s)
+}
+
+// Module abbreviations used by OpenFAST in linearization descriptions
+var linModules = map[string]bool{
+	"ED": true, "SED": true, "BD": true, "AD": true, "ADsk": true, "SrvD": true,
+	"IfW": true, "ExtInfw": true, "HD": true, "SD": true, "SeaSt": true,
+	"MAP": true, "MD": true, "FEAM": true, "Orca": true, "ExtPtfm": true,
+	"ExtLd": true, "IceF": true, "IceD": true,
+}
+
+// Prefixes indicating the order of time derivative of a state
+var derivPrefixes = []string{
+	"First time derivative of ",
+	"Second time derivative of ",
+}
+
+var (
+	internalDOFRe = regexp.MustCompile(`\s*\(internal DOF index = (.*)\)`)
+	nodeRe        = regexp.MustCompile(`(?i)(?:,\s*|\bof\s+)?\bnode\s+(\d+)`)
+	moduleRe      = regexp.MustCompile(`^([A-Za-z]+)(?:_(\w+))?$`)
+)
+
+// ParseDesc parses a linearization file description. Blade references are
+// found with the same expressions used to detect blade triplets, and MBC
+// coordinate names inserted by the multi-blade coordinate transform are
+// recognized in their place. Parts which aren't present are left empty.
+func ParseDesc(desc string) ChannelDesc {
+
+	cd := ChannelDesc{}
+	s := desc
+
+	// Internal DOF name
+	if m := internalDOFRe.FindStringSubmatchIndex(s); m != nil {
+		cd.DOF = s[m[2]:m[3]]
+		s = s[:m[0]] + s[m[1]:]
+	}
+
+	// Unit follows the last comma
+	if i := strings.LastIndex(s, ","); i != -1 {
+		cd.Unit = strings.TrimSpace(s[i+1:])
+		cd.Unit = strings.TrimSuffix(strings.TrimPrefix(cd.Unit, "("), ")")
+		s = s[:i]
+	}
+
+	// Time derivative, which may precede or follow the module
+	for i, prefix := range derivPrefixes {
+		if j := strings.Index(s, prefix); j != -1 {
+			cd.Deriv = i + 1
+			s = s[:j] + s[j+len(prefix):]
+			break
+		}
+	}
+
+	// Module and instance, BeamDyn instances are blades
+	fields := strings.Fields(s)
+	if len(fields) > 0 {
+		if m := moduleRe.FindStringSubmatch(fields[0]); m != nil && linModules[m[1]] {
+			cd.Module = m[1]
+			if n, err := strconv.Atoi(m[2]); err == nil {
+				cd.Instance = n
+				if cd.Module == "BD" {
+					cd.Blade = n
+				}
+			} else if isBladeCoordName(m[2]) {
+				cd.Coord = m[2]
+			}
+			fields = fields[1:]
+		}
+	}
+	s = strings.Join(fields, " ")
+
+	// Blade number
+	if cd.Blade == 0 && cd.Coord == "" {
+		for _, re := range bladeRe {
+			if m := re.FindStringSubmatchIndex(s); m != nil {
+				cd.Blade, _ = strconv.Atoi(s[m[2]:m[3]])
+				s = removeRef(s, m[0], m[1])
+				break
+			}
+		}
+	}
+
+	// MBC coordinate name in place of blade number
+	if cd.Blade == 0 && cd.Coord == "" {
+		s = parseCoordRef(s, &cd)
+	}
+
+	// Node number
+	if m := nodeRe.FindStringSubmatchIndex(s); m != nil {
+		cd.Node, _ = strconv.Atoi(s[m[2]:m[3]])
+		s = s[:m[0]] + s[m[1]:]
+	}
+
+	cd.Quantity = strings.Trim(strings.Join(strings.Fields(s), " "), " ,")
+
+	return cd
+}
+
+// parseCoordRef finds an MBC coordinate name following a blade reference word
+// (e.g. "blade collective"), stores it in the channel description, and
+// returns the string with the reference removed.
+func parseCoordRef(s string, cd *ChannelDesc) string {
+	words := strings.Fields(s)
+	for k := 1; k < len(words); k++ {
+		prev := strings.ToLower(words[k-1])
+		if prev != "blade" && prev != "root" && prev != "pitchbearing" {
+			continue
+		}
+		// Check two word names (e.g. "cosine 2") first
+		n := 0
+		if k+1 < len(words) && isBladeCoordName(words[k]+" "+words[k+1]) {
+			n = 2
+		} else if isBladeCoordName(words[k]) {
+			n = 1
+		}
+		if n == 0 {
+			continue
+		}
+		cd.Coord = strings.Join(words[k:k+n], " ")
+		start := k - 1
+		if prev == "root" && start > 0 && strings.EqualFold(words[start-1], "blade") {
+			start--
+		}
+		if start > 0 && words[start-1] == "of" {
+			start--
+		}
+		return strings.Join(append(words[:start:start], words[k+n:]...), " ")
+	}
+	return s
+}
+
+// removeRef removes s[start:end] and a preceding "of" from s.
+func removeRef(s string, start, end int) string {
+	prefix := strings.TrimRight(s[:start], " ")
+	if strings.HasSuffix(prefix, " of") || prefix == "of" {
+		prefix = strings.TrimSuffix(prefix, "of")
+	}
+	return prefix + " " + s[end:]
+}
+
+// Maximum number of blades for which MBC coordinate names are recognized
+const maxNamedBlades = 9
+
+// isBladeCoordName returns true if the name is an MBC coordinate name.
+func isBladeCoordName(name string) bool {
+	for _, n := range append(bladeCoordNames(maxNamedBlades), "differential") {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package anl_test
+
+import (
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestParseDesc(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		expected anl.ChannelDesc
+	}{
+		{"ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m",
+			anl.ChannelDesc{Module: "ED", Quantity: "1st tower fore-aft bending mode DOF", DOF: "DOF_TFA1", Unit: "m"}},
+		{"ED 1st flapwise bending-mode DOF of blade 2 (internal DOF index = DOF_BF(2,1)), m",
+			anl.ChannelDesc{Module: "ED", Blade: 2, Quantity: "1st flapwise bending-mode DOF", DOF: "DOF_BF(2,1)", Unit: "m"}},
+		{"ED 1st flapwise bending-mode DOF of blade cosine (internal DOF index = DOF_BF(2,1)), m",
+			anl.ChannelDesc{Module: "ED", Coord: "cosine", Quantity: "1st flapwise bending-mode DOF", DOF: "DOF_BF(2,1)", Unit: "m"}},
+		{"First time derivative of ED Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s",
+			anl.ChannelDesc{Module: "ED", Deriv: 1, Quantity: "Variable speed generator DOF", DOF: "DOF_GeAz", Unit: "rad/s"}},
+		{"ED First time derivative of Nacelle yaw DOF (internal DOF index = DOF_Yaw), rad/s",
+			anl.ChannelDesc{Module: "ED", Deriv: 1, Quantity: "Nacelle yaw DOF", DOF: "DOF_Yaw", Unit: "rad/s"}},
+		{"ED Blade 3 pitch command, rad",
+			anl.ChannelDesc{Module: "ED", Blade: 3, Quantity: "pitch command", Unit: "rad"}},
+		{"ED Blade cosine 2 pitch command, rad",
+			anl.ChannelDesc{Module: "ED", Coord: "cosine 2", Quantity: "pitch command", Unit: "rad"}},
+		{"ED RotSpeed, (rpm)",
+			anl.ChannelDesc{Module: "ED", Quantity: "RotSpeed", Unit: "rpm"}},
+		{"BD_2 Node 5 translational displacement in X, m",
+			anl.ChannelDesc{Module: "BD", Instance: 2, Blade: 2, Node: 5, Quantity: "translational displacement in X", Unit: "m"}},
+		{"BD_collective First order state 1, -",
+			anl.ChannelDesc{Module: "BD", Coord: "collective", Quantity: "First order state 1", Unit: "-"}},
+		{"AD Blade 1, node 12, Vx, m/s",
+			anl.ChannelDesc{Module: "AD", Blade: 1, Node: 12, Quantity: "Vx", Unit: "m/s"}},
+		{"IfW Extended input: horizontal wind speed (steady/uniform wind), m/s",
+			anl.ChannelDesc{Module: "IfW", Quantity: "Extended input: horizontal wind speed (steady/uniform wind)", Unit: "m/s"}},
+		{"Generator torque",
+			anl.ChannelDesc{Quantity: "Generator torque"}},
+	} {
+		if cd := anl.ParseDesc(tc.desc); cd != tc.expected {
+			t.Errorf("ParseDesc(%q) = %+v, expected %+v", tc.desc, cd, tc.expected)
+		}
+	}
+}
+
+func TestFindBladeTriplets(t *testing.T) {
+
+	// Blade DOFs listed out of order with a fixed frame state in between
+	linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+	for _, ld := range linData {
+		ld.U = []anl.OperPointData{
+			{RC: 1, IsRotating: true, Desc: "ED Blade 2 pitch command, rad"},
+			{RC: 2, IsRotating: true, Desc: "ED Blade 1 pitch command, rad"},
+			{RC: 3, Desc: "ED Generator torque, Nm"},
+			{RC: 4, IsRotating: true, Desc: "ED Blade 3 pitch command, rad"},
+		}
+	}
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	triplets := md.Rotation.TripletsInputs
+	if len(triplets) != 1 || len(triplets[0]) != 3 ||
+		triplets[0][0] != 2 || triplets[0][1] != 1 || triplets[0][2] != 4 {
+		t.Fatalf("TripletsInputs = %v, expected [[2 1 4]]", triplets)
+	}
+	expected := []string{
+		"ED Generator torque, Nm",
+		"ED Blade collective pitch command, rad",
+		"ED Blade cosine pitch command, rad",
+		"ED Blade sine pitch command, rad",
+	}
+	for i, op := range md.DescInputs {
+		if op.Desc != expected[i] {
+			t.Errorf("DescInputs[%d] = %q, expected %q", i, op.Desc, expected[i])
+		}
+	}
+}
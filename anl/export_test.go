@@ -0,0 +1,11 @@
+package anl
+
+// Export unexported functions for testing
+var CollectMatrixData = collectMatrixData
+var ModeName = modeName
+var NormalizeShape = normalizeShape
+var FloquetAnalysis = floquetAnalysis
+var ResidualPeriodicity = residualPeriodicity
+var ClosedLoopAnalysis = closedLoopAnalysis
+var LinReaderBufSize = &linReaderBufSize
+var NewMATFile = newMATFile
@@ -0,0 +1,149 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Modal analysis methods
+const (
+	ModalMethodMBC     = "mbc"     // Eigenanalysis of azimuth averaged MBC state matrix
+	ModalMethodFloquet = "floquet" // Floquet analysis of periodic MBC state matrices
+)
+
+// FloquetResults contains the results of Floquet analysis of the periodic
+// MBC state matrices over one rotor revolution.
+type FloquetResults struct {
+	Period float64        // Rotor revolution period (s)
+	Time   []float64      // Time of each azimuth within the period (s)
+	Modes  []*ModeResults // Modes from the Floquet exponents
+}
+
+// floquetAnalysis computes the state transition (monodromy) matrix over one
+// rotor revolution from the azimuth-sampled MBC state matrices and derives the
+// Floquet exponents and periodic mode shapes. The state matrix is taken as the
+// average of neighboring samples over each azimuth interval, so the transition
+// matrix is exact for a constant state matrix.
+func floquetAnalysis(md *MatData) (*FloquetResults, error) {
+
+	// Rotor speed must be nonzero for the system to be periodic
+	omega := mat.Sum(md.Omega) / float64(md.NumStep)
+	if omega == 0 {
+		return nil, fmt.Errorf("floquet analysis requires nonzero rotor speed")
+	}
+	period := 2 * math.Pi / math.Abs(omega)
+
+	fr := &FloquetResults{
+		Period: period,
+		Time:   make([]float64, md.NumStep),
+	}
+
+	// Time of each azimuth relative to the first, azimuths are sorted
+	az0 := md.Azimuth.AtVec(0)
+	for i := range fr.Time {
+		fr.Time[i] = (md.Azimuth.AtVec(i) - az0) * math.Pi / 180 / math.Abs(omega)
+	}
+
+	// Integrate state transition matrix over revolution, saving the matrix
+	// at each azimuth for the periodic mode shapes
+	phis := make([]*mat.Dense, md.NumStep)
+	phi := eye(md.NumStates)
+	aMid := mat.NewDense(md.NumStates, md.NumStates, nil)
+	expA := mat.NewDense(md.NumStates, md.NumStates, nil)
+	for i := 0; i < md.NumStep; i++ {
+		phis[i] = mat.DenseCopyOf(phi)
+
+		// Time step to the next azimuth, the last wraps to the first
+		j := (i + 1) % md.NumStep
+		dt := period - fr.Time[i]
+		if j > 0 {
+			dt = fr.Time[j] - fr.Time[i]
+		}
+
+		aMid.Add(md.A[i], md.A[j])
+		aMid.Scale(0.5*dt, aMid)
+		expA.Exp(aMid)
+		phi.Mul(expA, phi)
+	}
+
+	// Eigenanalysis of monodromy matrix
+	eig := mat.Eigen{}
+	if ok := eig.Factorize(phi, mat.EigenRight); !ok {
+		return nil, fmt.Errorf("error computing floquet multipliers")
+	}
+	eigvecs := &mat.CDense{}
+	eig.VectorsTo(eigvecs)
+
+	// Eigenvalues of the averaged state matrix are used to resolve the
+	// frequency ambiguity of the Floquet exponents
+	avgEig := mat.Eigen{}
+	if ok := avgEig.Factorize(md.AvgA, mat.EigenNone); !ok {
+		return nil, fmt.Errorf("error computing eigenvalues")
+	}
+	avgValues := avgEig.Values(nil)
+
+	// Eigenvector rows to keep in mode shapes
+	vecRows := modeRows(md)
+
+	for i, mult := range eig.Values(nil) {
+
+		// Skip multipliers of zero, the exponent is undefined
+		if mult == 0 {
+			continue
+		}
+
+		// Floquet exponent, with frequency shifted by the multiple of rotor
+		// speed which brings it closest to an averaged eigenvalue
+		ev := floquetExponent(mult, period, math.Abs(omega), avgValues)
+		if imag(ev) < 0 {
+			continue
+		}
+
+		eigvec := make([]complex128, md.NumStates)
+		for r := range eigvec {
+			eigvec[r] = eigvecs.At(r, i)
+		}
+		mode := newModeResults(md, ev, eigvec, vecRows)
+
+		// Periodic mode shape at each azimuth, p(t) = exp(-ev*t)*Phi(t)*v
+		mode.PeriodicShapes = make([][]complex128, md.NumStep)
+		for k, t := range fr.Time {
+			scale := cmplx.Exp(-ev * complex(t, 0))
+			shape := make([]complex128, len(vecRows))
+			for j, r := range vecRows {
+				for c, v := range eigvec {
+					shape[j] += complex(phis[k].At(r, c), 0) * v
+				}
+				shape[j] *= scale
+			}
+			mode.PeriodicShapes[k] = shape
+		}
+
+		fr.Modes = append(fr.Modes, mode)
+	}
+
+	// Sort modes by natural frequency
+	sortModes(fr.Modes)
+
+	return fr, nil
+}
+
+// floquetExponent returns the Floquet exponent of the multiplier over the
+// period. The exponent frequency is only defined to within a multiple of the
+// rotor speed, so the multiple which brings the exponent closest to one of the
+// reference eigenvalues is chosen.
+func floquetExponent(mult complex128, period, omega float64, ref []complex128) complex128 {
+	ev := cmplx.Log(mult) / complex(period, 0)
+	best, bestDist := ev, math.Inf(1)
+	for _, r := range ref {
+		m := math.Round((imag(r) - imag(ev)) / omega)
+		shifted := ev + complex(0, m*omega)
+		if d := cmplx.Abs(shifted - r); d < bestDist {
+			best, bestDist = shifted, d
+		}
+	}
+	return best
+}
@@ -0,0 +1,115 @@
+package anl_test
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestFloquetAnalysis(t *testing.T) {
+
+	// System is constant in the fixed frame, so Floquet results must match
+	// the eigenanalysis of the averaged state matrix
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr, err := anl.FloquetAnalysis(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := 2 * math.Pi / 1.2; math.Abs(fr.Period-exp) > 1e-12 {
+		t.Fatalf("Period = %v, expected %v", fr.Period, exp)
+	}
+	if len(fr.Modes) != len(md.Modes) {
+		t.Fatalf("got %d Floquet modes, expected %d", len(fr.Modes), len(md.Modes))
+	}
+	for i, mode := range fr.Modes {
+		if d := cmplx.Abs(mode.EigenValue - md.Modes[i].EigenValue); d > 1e-8 {
+			t.Errorf("mode %d: EigenValue = %v, expected %v", i, mode.EigenValue, md.Modes[i].EigenValue)
+		}
+		if mac := anl.MAC(mode.EigenVector, md.Modes[i].EigenVector); mac < 1-1e-8 {
+			t.Errorf("mode %d: MAC with averaged mode = %v", i, mac)
+		}
+
+		// Periodic mode shape is constant for a constant system
+		if len(mode.PeriodicShapes) != len(azimuths) {
+			t.Fatalf("mode %d: got %d periodic shapes, expected %d", i, len(mode.PeriodicShapes), len(azimuths))
+		}
+		for k, shape := range mode.PeriodicShapes {
+			for j, v := range shape {
+				if cmplx.Abs(v-mode.EigenVector[j]) > 1e-8 {
+					t.Fatalf("mode %d: periodic shape %d row %d = %v, expected %v", i, k, j, v, mode.EigenVector[j])
+				}
+			}
+		}
+	}
+}
+
+func TestFloquetAnalysisPeriodic(t *testing.T) {
+
+	// Scalar system x' = (-1 + 0.5*cos(psi))*x has a Floquet exponent equal
+	// to the mean of the state coefficient over the revolution
+	numSteps := 8
+	linData := make([]*anl.LinData, numSteps)
+	for i := range linData {
+		psi := 2 * math.Pi * float64(i) / float64(numSteps)
+		linData[i] = &anl.LinData{
+			Azimuth:    psi,
+			RotorSpeed: 0.8,
+			NumX:       1,
+			X: []anl.OperPointData{
+				{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"},
+			},
+			A: mat.NewDense(1, 1, []float64{-1 + 0.5*math.Cos(psi)}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fr, err := anl.FloquetAnalysis(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(fr.Modes) != 1 {
+		t.Fatalf("got %d Floquet modes, expected 1", len(fr.Modes))
+	}
+	if ev := fr.Modes[0].EigenValue; cmplx.Abs(ev-(-1)) > 1e-12 {
+		t.Fatalf("EigenValue = %v, expected -1", ev)
+	}
+
+	// Periodic shape is exp(0.5*sin(psi)/omega) within the discretization
+	// error of the azimuth intervals
+	shapes := fr.Modes[0].PeriodicShapes
+	for k, psi := range []float64{0, math.Pi / 2} {
+		exp := math.Exp(0.5 * math.Sin(psi) / 0.8)
+		act := cmplx.Abs(shapes[2*k][0] / shapes[0][0])
+		if math.Abs(act-exp) > 0.05*exp {
+			t.Errorf("periodic shape at %v rad = %v, expected %v", psi, act, exp)
+		}
+	}
+
+	// Rotor speed is required
+	for _, ld := range linData {
+		ld.RotorSpeed = 0
+	}
+	if md, err = anl.CollectMatrixData(linData, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := anl.FloquetAnalysis(md); err == nil {
+		t.Fatal("expected error for zero rotor speed")
+	}
+}
@@ -0,0 +1,239 @@
+package anl
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"strings"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// FreqResponse contains the frequency response of the azimuth averaged MBC
+// state-space model from one input to one output.
+type FreqResponse struct {
+	ConditionID int
+	Input       string    // Input description
+	Output      string    // Output description
+	FreqHz      []float64 // Frequency (Hz)
+	Magnitude   []float64 // Magnitude (output units / input units)
+	MagnitudeDB []float64 // Magnitude (dB), not less than minMagnitudeDB
+	Phase       []float64 // Unwrapped phase (deg)
+}
+
+// Errors returned by the frequency response functions, which may be wrapped
+// and checked with errors.Is
+var (
+	ErrInvalidFrequency = errors.New("invalid frequency")
+	ErrInvalidChannel   = errors.New("invalid channel")
+	ErrMBCNotFound      = errors.New("MBC results not found")
+)
+
+// Floor of the magnitude in decibels, so a zero magnitude isn't -Inf which
+// can't be encoded as JSON
+const minMagnitudeDB = -400
+
+// FrequencyResponse computes the frequency response of the azimuth averaged
+// state-space model from the named input to the named output at the given
+// frequencies (Hz). See MBC.FrequencyResponse for name matching and cost.
+func (md *MatData) FrequencyResponse(input, output string, freqHz []float64) (*FreqResponse, error) {
+	if md.AvgB == nil || md.AvgC == nil {
+		return nil, fmt.Errorf("%w, model has no input or output matrices", ErrInvalidChannel)
+	}
+	var D mat.Matrix
+	if md.AvgD != nil {
+		D = md.AvgD
+	}
+	return frequencyResponse(md.AvgA, md.AvgB, md.AvgC, D,
+		descriptions(md.DescInputs), descriptions(md.DescOutputs), input, output, freqHz)
+}
+
+// FrequencyResponse computes the frequency response of the azimuth averaged
+// state-space model from the named input to the named output at the given
+// frequencies (Hz). Names match a description exactly or, failing that, a
+// unique description which contains the name ignoring case. Frequencies must
+// be positive, as the response at 0 Hz is undefined for models with rigid
+// body states such as the generator azimuth. Each frequency requires a dense
+// solve of twice the number of states, O(n^3), so for models with thousands
+// of states use a model from MatData.BalancedTruncation or ModalTruncation.
+func (mbc *MBC) FrequencyResponse(input, output string, freqHz []float64) (*FreqResponse, error) {
+	if mbc.AvgB == nil || mbc.AvgC == nil {
+		return nil, fmt.Errorf("%w, model has no input or output matrices", ErrInvalidChannel)
+	}
+	var D mat.Matrix
+	if mbc.AvgD != nil {
+		D = sliceToDense(mbc.AvgD)
+	}
+	return frequencyResponse(sliceToDense(mbc.AvgA), sliceToDense(mbc.AvgB), sliceToDense(mbc.AvgC), D,
+		mbc.DescInputs, mbc.DescOutputs, input, output, freqHz)
+}
+
+// FrequencyResponses computes the frequency response from the named input to
+// the named output for each condition from the MBC results. ErrMBCNotFound is
+// returned if a condition hasn't been evaluated.
+func (a *Analysis) FrequencyResponses(input, output string, freqHz []float64) ([]*FreqResponse, error) {
+	frs := make([]*FreqResponse, len(a.Conditions))
+	for i, c := range a.Conditions {
+		mbc, err := ReadMBC(NewTurbine(c, nil).MBCPath())
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("condition %d: %w, it may not have been evaluated", c.ID, ErrMBCNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading MBC results for condition %d: %w", c.ID, err)
+		}
+		if frs[i], err = mbc.FrequencyResponse(input, output, freqHz); err != nil {
+			return nil, fmt.Errorf("error computing frequency response for condition %d: %w", c.ID, err)
+		}
+		frs[i].ConditionID = c.ID
+	}
+	return frs, nil
+}
+
+// LogFrequencies returns n logarithmically spaced frequencies from min to max
+// inclusive.
+func LogFrequencies(min, max float64, n int) ([]float64, error) {
+	if min <= 0 || max < min {
+		return nil, fmt.Errorf("%w range [%v, %v]", ErrInvalidFrequency, min, max)
+	}
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of frequencies %d", n)
+	}
+	freqs := make([]float64, n)
+	freqs[0] = min
+	for i := 1; i < n; i++ {
+		freqs[i] = min * math.Pow(max/min, float64(i)/float64(n-1))
+	}
+	return freqs, nil
+}
+
+// WriteCSV writes the frequency response as a table with columns of
+// frequency, magnitude, magnitude in dB, and phase.
+func (fr *FreqResponse) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"Frequency (Hz)", "Magnitude", "Magnitude (dB)", "Phase (deg)"}); err != nil {
+		return err
+	}
+	format := func(v float64) string { return strconv.FormatFloat(v, 'g', -1, 64) }
+	for i, f := range fr.FreqHz {
+		row := []string{format(f), format(fr.Magnitude[i]), format(fr.MagnitudeDB[i]), format(fr.Phase[i])}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// frequencyResponse evaluates G(jw) = C*(jw*I - A)^-1*B + D for the input and
+// output found by name in the descriptions. D may be nil. Frequencies must be
+// positive.
+func frequencyResponse(A, B, C, D mat.Matrix, descInputs, descOutputs []string,
+	input, output string, freqHz []float64) (*FreqResponse, error) {
+
+	for _, f := range freqHz {
+		if !(f > 0) {
+			return nil, fmt.Errorf("%w %v Hz, frequencies must be greater than zero", ErrInvalidFrequency, f)
+		}
+	}
+
+	in, err := findChannel(descInputs, input)
+	if err != nil {
+		return nil, fmt.Errorf("input: %w", err)
+	}
+	out, err := findChannel(descOutputs, output)
+	if err != nil {
+		return nil, fmt.Errorf("output: %w", err)
+	}
+
+	fr := &FreqResponse{
+		Input:       descInputs[in],
+		Output:      descOutputs[out],
+		FreqHz:      freqHz,
+		Magnitude:   make([]float64, len(freqHz)),
+		MagnitudeDB: make([]float64, len(freqHz)),
+		Phase:       make([]float64, len(freqHz)),
+	}
+
+	n, _ := A.Dims()
+	d := 0.0
+	if D != nil {
+		d = D.At(out, in)
+	}
+
+	// Complex system (jw*I - A)*x = b is solved as the equivalent real system
+	// [-A, -wI; wI, -A]*[xr; xi] = [b; 0]
+	M := mat.NewDense(2*n, 2*n, nil)
+	negA := &mat.Dense{}
+	negA.Scale(-1, A)
+	M.Slice(0, n, 0, n).(*mat.Dense).Copy(negA)
+	M.Slice(n, 2*n, n, 2*n).(*mat.Dense).Copy(negA)
+	rhs := mat.NewVecDense(2*n, nil)
+	for i := 0; i < n; i++ {
+		rhs.SetVec(i, B.At(i, in))
+	}
+	x := mat.NewVecDense(2*n, nil)
+
+	prevPhase := 0.0
+	for k, f := range freqHz {
+		w := 2 * math.Pi * f
+		for i := 0; i < n; i++ {
+			M.Set(i, n+i, -w)
+			M.Set(n+i, i, w)
+		}
+		if err := x.SolveVec(M, rhs); err != nil {
+			return nil, fmt.Errorf("error solving at %v Hz, the model may have a rigid body state: %w", f, err)
+		}
+
+		g := complex(d, 0)
+		for i := 0; i < n; i++ {
+			g += complex(C.At(out, i), 0) * complex(x.AtVec(i), x.AtVec(n+i))
+		}
+
+		fr.Magnitude[k] = cmplx.Abs(g)
+		fr.MagnitudeDB[k] = math.Max(20*math.Log10(fr.Magnitude[k]), minMagnitudeDB)
+
+		// Unwrap phase relative to previous frequency
+		phase := cmplx.Phase(g) * 180 / math.Pi
+		if k > 0 {
+			phase += 360 * math.Round((prevPhase-phase)/360)
+		}
+		fr.Phase[k] = phase
+		prevPhase = phase
+	}
+
+	return fr, nil
+}
+
+// findChannel returns the index of the description which matches the name
+// exactly or, failing that, the unique description which contains the name
+// ignoring case.
+func findChannel(desc []string, name string) (int, error) {
+	for i, d := range desc {
+		if d == name {
+			return i, nil
+		}
+	}
+	matches := []int{}
+	lower := strings.ToLower(name)
+	for i, d := range desc {
+		if strings.Contains(strings.ToLower(d), lower) {
+			matches = append(matches, i)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("%w, no channel matches '%s'", ErrInvalidChannel, name)
+	case 1:
+		return matches[0], nil
+	}
+	names := make([]string, len(matches))
+	for i, m := range matches {
+		names[i] = "'" + desc[m] + "'"
+	}
+	return 0, fmt.Errorf("%w, '%s' matches multiple channels: %s", ErrInvalidChannel, name, strings.Join(names, ", "))
+}
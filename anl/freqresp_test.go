@@ -0,0 +1,206 @@
+package anl_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestFrequencyResponse(t *testing.T) {
+
+	// First order system x' = -x + 2u, y = 3x + 0.5u with two outputs
+	linData := make([]*anl.LinData, 4)
+	for i := range linData {
+		linData[i] = &anl.LinData{
+			Azimuth:    math.Pi / 2 * float64(i),
+			RotorSpeed: 1,
+			NumX:       1,
+			NumU:       1,
+			NumY:       2,
+			X:          []anl.OperPointData{{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"}},
+			U:          []anl.OperPointData{{RC: 1, Desc: "ED Generator torque, Nm"}},
+			Y: []anl.OperPointData{
+				{RC: 1, Desc: "ED GenSpeed, (rpm)"},
+				{RC: 2, Desc: "ED GenAccel, (deg/s^2)"},
+			},
+			A: mat.NewDense(1, 1, []float64{-1}),
+			B: mat.NewDense(1, 1, []float64{2}),
+			C: mat.NewDense(2, 1, []float64{3, 1}),
+			D: mat.NewDense(2, 1, []float64{0.5, 0}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freqHz, err := anl.LogFrequencies(0.01, 10, 31)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(freqHz[30]-10) > 1e-12 || math.Abs(freqHz[10]-0.1) > 1e-12 {
+		t.Fatalf("unexpected frequencies %v", freqHz)
+	}
+
+	check := func(fr *anl.FreqResponse) {
+		t.Helper()
+		if fr.Input != "ED Generator torque, Nm" || fr.Output != "ED GenSpeed, (rpm)" {
+			t.Fatalf("Input = %q, Output = %q", fr.Input, fr.Output)
+		}
+		for i, f := range freqHz {
+			g := 6/complex(1, 2*math.Pi*f) + 0.5
+			if math.Abs(fr.Magnitude[i]-cmplx.Abs(g)) > 1e-10 {
+				t.Fatalf("Magnitude at %v Hz = %v, expected %v", f, fr.Magnitude[i], cmplx.Abs(g))
+			}
+			if math.Abs(fr.MagnitudeDB[i]-20*math.Log10(cmplx.Abs(g))) > 1e-10 {
+				t.Fatalf("MagnitudeDB at %v Hz = %v", f, fr.MagnitudeDB[i])
+			}
+			if exp := cmplx.Phase(g) * 180 / math.Pi; math.Abs(fr.Phase[i]-exp) > 1e-8 {
+				t.Fatalf("Phase at %v Hz = %v, expected %v", f, fr.Phase[i], exp)
+			}
+		}
+	}
+
+	// From matrix data, names match substrings ignoring case
+	fr, err := md.FrequencyResponse("generator torque", "genspeed", freqHz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(fr)
+
+	// From MBC results, names match exactly
+	fr, err = anl.NewMBC(md).FrequencyResponse("ED Generator torque, Nm", "ED GenSpeed, (rpm)", freqHz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	check(fr)
+
+	// Tabular output
+	buf := &bytes.Buffer{}
+	if err := fr.WriteCSV(buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(freqHz)+1 || lines[0] != "Frequency (Hz),Magnitude,Magnitude (dB),Phase (deg)" {
+		t.Fatalf("unexpected CSV output:\n%s", buf.String())
+	}
+
+	// Unknown and ambiguous channels
+	if _, err := md.FrequencyResponse("pitch", "GenSpeed", freqHz); !errors.Is(err, anl.ErrInvalidChannel) {
+		t.Errorf("error = %v, expected invalid channel for unknown input", err)
+	}
+	if _, err := md.FrequencyResponse("torque", "ED Gen", freqHz); !errors.Is(err, anl.ErrInvalidChannel) {
+		t.Errorf("error = %v, expected invalid channel for ambiguous output", err)
+	}
+
+	// Conditions which haven't been evaluated have no MBC results
+	a := &anl.Analysis{Conditions: []anl.Conditions{{ID: 99}}}
+	if _, err := a.FrequencyResponses("torque", "GenSpeed", freqHz); !errors.Is(err, anl.ErrMBCNotFound) {
+		t.Errorf("error = %v, expected MBC results not found", err)
+	}
+}
+
+func TestFrequencyResponseZeroFrequency(t *testing.T) {
+
+	// Drivetrain model with the rigid body generator azimuth state, where
+	// (jw*I - A) is singular at 0 Hz
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = md.FrequencyResponse("generator torque", "rotspeed", []float64{0, 0.1})
+	if !errors.Is(err, anl.ErrInvalidFrequency) || !strings.Contains(err.Error(), "invalid frequency 0 Hz") {
+		t.Fatalf("error = %v, expected invalid frequency error", err)
+	}
+	if _, err := md.FrequencyResponse("generator torque", "rotspeed", []float64{0.01, 0.1}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFrequencyResponsePhaseUnwrap(t *testing.T) {
+
+	// Third order lag 1/(s+1)^3 has phase continuing past -180 deg
+	A := mat.NewDense(3, 3, []float64{-1, 1, 0, 0, -1, 1, 0, 0, -1})
+	linData := make([]*anl.LinData, 1)
+	linData[0] = &anl.LinData{
+		RotorSpeed: 1,
+		NumX:       3,
+		NumU:       1,
+		NumY:       1,
+		X: []anl.OperPointData{
+			{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state 1, -"},
+			{RC: 2, DerivOrder: 1, Desc: "BD_1 First order state 2, -"},
+			{RC: 3, DerivOrder: 1, Desc: "BD_1 First order state 3, -"},
+		},
+		U: []anl.OperPointData{{RC: 1, Desc: "Input, -"}},
+		Y: []anl.OperPointData{{RC: 1, Desc: "Output, -"}},
+		A: A,
+		B: mat.NewDense(3, 1, []float64{0, 0, 1}),
+		C: mat.NewDense(1, 3, []float64{1, 0, 0}),
+		D: mat.NewDense(1, 1, nil),
+	}
+	linData[0].Xd = linData[0].X
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freqHz, _ := anl.LogFrequencies(0.01, 10, 50)
+	fr, err := md.FrequencyResponse("Input", "Output", freqHz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, f := range freqHz {
+		exp := -3 * math.Atan(2*math.Pi*f) * 180 / math.Pi
+		if math.Abs(fr.Phase[i]-exp) > 1e-8 {
+			t.Fatalf("Phase at %v Hz = %v, expected %v", f, fr.Phase[i], exp)
+		}
+	}
+}
+
+func TestFrequencyResponseZeroMagnitude(t *testing.T) {
+
+	// Input has no path to the output, so the magnitude is zero
+	linData := make([]*anl.LinData, 4)
+	for i := range linData {
+		linData[i] = &anl.LinData{
+			Azimuth:    math.Pi / 2 * float64(i),
+			RotorSpeed: 1,
+			NumX:       1,
+			NumU:       1,
+			NumY:       1,
+			X:          []anl.OperPointData{{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"}},
+			U:          []anl.OperPointData{{RC: 1, Desc: "ED Generator torque, Nm"}},
+			Y:          []anl.OperPointData{{RC: 1, Desc: "ED GenSpeed, (rpm)"}},
+			A:          mat.NewDense(1, 1, []float64{-1}),
+			B:          mat.NewDense(1, 1, []float64{0}),
+			C:          mat.NewDense(1, 1, []float64{3}),
+			D:          mat.NewDense(1, 1, []float64{0}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fr, err := md.FrequencyResponse("generator torque", "genspeed", []float64{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range fr.MagnitudeDB {
+		if v != -400 {
+			t.Errorf("MagnitudeDB[%d] = %v, expected -400", i, v)
+		}
+	}
+	if _, err := json.Marshal(fr); err != nil {
+		t.Fatal(err)
+	}
+}
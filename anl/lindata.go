@@ -2,7 +2,11 @@ package anl
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"os"
 	"strconv"
 	"strings"
@@ -22,8 +26,12 @@ type LinData struct {
 	NumZ           int
 	NumU           int
 	NumY           int
+	HasJacobians   bool
 	X, Xd, Z, U, Y []OperPointData
 	A, B, C, D     *mat.Dense
+
+	// Glue code Jacobians, only present if HasJacobians (LinOutJac)
+	DUdu, DUdy, DXdy *mat.Dense
 }
 
 type OperPointData struct {
@@ -32,30 +40,42 @@ type OperPointData struct {
 	IsRotating bool
 	DerivOrder int
 	Desc       string
+
+	// Orientation operating points are written as three comma separated
+	// values, OperPoint is the first and Orientation holds all three
+	Orientation []float64 `json:",omitempty"`
 }
 
+// ReadLinData reads a linearization file. Lines may be of any length, so
+// files with thousands of states, inputs, or outputs are supported. Table
+// lengths and matrix dimensions are validated against the counts in the file
+// header and errors include the line number.
 func ReadLinData(filePath string) (*LinData, error) {
 
-	linData := &LinData{FilePath: filePath}
-
-	linFile, err := os.Open(linData.FilePath)
+	linFile, err := os.Open(filePath)
 	if err != nil {
-		return linData, err
+		return nil, err
 	}
 	defer linFile.Close()
 
-	scanner := bufio.NewScanner(linFile)
+	return readLinData(linFile, filePath)
+}
+
+// readLinData reads linearization data from r, using filePath for errors.
+func readLinData(r io.Reader, filePath string) (*LinData, error) {
+
+	var err error
+	linData := &LinData{FilePath: filePath}
+	lr := newLinReader(r, filePath)
 
 	//--------------------------------------------------------------------------
 	// Header
 	//--------------------------------------------------------------------------
 
-	hasJacobians := false
-
-	for scanner.Scan() {
+	for lr.Scan() {
 
 		// Get line without leading/trailing whitespace, skip if empty
-		line := strings.TrimSpace(scanner.Text())
+		line := lr.Text()
 		if len(line) == 0 {
 			continue
 		}
@@ -63,52 +83,57 @@ func ReadLinData(filePath string) (*LinData, error) {
 		// Split line into fields
 		fields := strings.Fields(line)
 
-		if strings.HasPrefix(line, "Simulation time") {
-			if linData.SimTime, err = strconv.ParseFloat(fields[2], 64); err != nil {
-				return nil, fmt.Errorf("error parsing Simulation time: %w", err)
+		// headerInt parses the integer count in the field
+		headerInt := func(i int, name string) (int, error) {
+			if i >= len(fields) {
+				return 0, lr.Errorf("missing value for %s", name)
 			}
-		} else if strings.HasPrefix(line, "Rotor Speed") {
-			if linData.RotorSpeed, err = strconv.ParseFloat(fields[2], 64); err != nil {
-				return nil, fmt.Errorf("error parsing Rotor Speed: %w", err)
+			v, err := strconv.Atoi(fields[i])
+			if err != nil {
+				return 0, lr.Errorf("error parsing %s: %w", name, err)
 			}
-		} else if strings.HasPrefix(line, "Azimuth") {
-			if linData.Azimuth, err = strconv.ParseFloat(fields[1], 64); err != nil {
-				return nil, fmt.Errorf("error parsing Azimuth: %w", err)
+			return v, nil
+		}
+
+		// headerFloat parses the floating point value in the field
+		headerFloat := func(i int, name string) (float64, error) {
+			if i >= len(fields) {
+				return 0, lr.Errorf("missing value for %s", name)
 			}
-		} else if strings.HasPrefix(line, "Wind Speed") {
-			if linData.WindSpeed, err = strconv.ParseFloat(fields[2], 64); err != nil {
-				return nil, fmt.Errorf("error parsing Wind Speed: %w", err)
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return 0, lr.Errorf("error parsing %s: %w", name, err)
 			}
+			return v, nil
+		}
+
+		if strings.HasPrefix(line, "Simulation time") {
+			linData.SimTime, err = headerFloat(2, "Simulation time")
+		} else if strings.HasPrefix(line, "Rotor Speed") {
+			linData.RotorSpeed, err = headerFloat(2, "Rotor Speed")
+		} else if strings.HasPrefix(line, "Azimuth") {
+			linData.Azimuth, err = headerFloat(1, "Azimuth")
+		} else if strings.HasPrefix(line, "Wind Speed") {
+			linData.WindSpeed, err = headerFloat(2, "Wind Speed")
 		} else if strings.HasPrefix(line, "Number of continuous states") {
-			if linData.NumX, err = strconv.Atoi(fields[4]); err != nil {
-				return nil, fmt.Errorf("error parsing Number of continuous states: %w", err)
-			}
+			linData.NumX, err = headerInt(4, "Number of continuous states")
 		} else if strings.HasPrefix(line, "Number of discrete states") {
-			if linData.NumXd, err = strconv.Atoi(fields[4]); err != nil {
-				return nil, fmt.Errorf("error parsing Number of discrete states: %w", err)
-			}
+			linData.NumXd, err = headerInt(4, "Number of discrete states")
 		} else if strings.HasPrefix(line, "Number of constraint states") {
-			if linData.NumZ, err = strconv.Atoi(fields[4]); err != nil {
-				return nil, fmt.Errorf("error parsing Number of constraint states: %w", err)
-			}
+			linData.NumZ, err = headerInt(4, "Number of constraint states")
 		} else if strings.HasPrefix(line, "Number of inputs") {
-			if linData.NumU, err = strconv.Atoi(fields[3]); err != nil {
-				return nil, fmt.Errorf("error parsing Number of inputs: %w", err)
-			}
+			linData.NumU, err = headerInt(3, "Number of inputs")
 		} else if strings.HasPrefix(line, "Number of outputs") {
-			if linData.NumY, err = strconv.Atoi(fields[3]); err != nil {
-				return nil, fmt.Errorf("error parsing Number of outputs: %w", err)
-			}
+			linData.NumY, err = headerInt(3, "Number of outputs")
 		} else if strings.HasPrefix(line, "Jacobians included") {
-			if fields[5] == "Yes" {
-				hasJacobians = true
-			}
+			linData.HasJacobians = fields[len(fields)-1] == "Yes"
 			break
 		}
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	_ = hasJacobians
-
 	//--------------------------------------------------------------------------
 	// Operating points
 	//--------------------------------------------------------------------------
@@ -117,61 +142,112 @@ func ReadLinData(filePath string) (*LinData, error) {
 	hasDeriv := false
 	defaultDeriv := 0
 
-	for scanner.Scan() {
+	for lr.Scan() {
 
-		line := strings.TrimSpace(scanner.Text())
+		line := lr.Bytes()
 		if len(line) == 0 {
 			continue
 		}
 
-		fields := strings.Fields(line)
-
-		if strings.HasPrefix(line, "Row/Column") {
-			hasDeriv = strings.Contains(line, "Derivative Order")
-		} else if strings.HasPrefix(line, "Order of continuous states") {
-			currentOP = &linData.X
-			defaultDeriv = 2
-		} else if strings.HasPrefix(line, "Order of continuous state derivatives") {
-			currentOP = &linData.Xd
-			defaultDeriv = 2
-		} else if strings.HasPrefix(line, "Linearized state matrices") {
+		if bytes.Contains(line, []byte("Operating Point")) {
+			// Column header, labeled "Row/Column" for states, "Column" for
+			// inputs, and "Row" for outputs
+			hasDeriv = bytes.Contains(line, []byte("Derivative Order"))
+		} else if bytes.HasPrefix(line, []byte("Order of")) {
+			// Table title, the derivative order column is only present if
+			// the following header includes it
+			hasDeriv = false
+			currentOP, defaultDeriv = nil, 0
+			switch {
+			case bytes.HasPrefix(line, []byte("Order of continuous states")):
+				currentOP, defaultDeriv = &linData.X, 2
+			case bytes.HasPrefix(line, []byte("Order of continuous state derivatives")):
+				currentOP, defaultDeriv = &linData.Xd, 2
+			case bytes.HasPrefix(line, []byte("Order of inputs")):
+				currentOP = &linData.U
+			case bytes.HasPrefix(line, []byte("Order of outputs")):
+				currentOP = &linData.Y
+			case bytes.HasPrefix(line, []byte("Order of constraint states")):
+				currentOP = &linData.Z
+			}
+		} else if bytes.HasPrefix(line, []byte("Jacobian matrices")) ||
+			bytes.HasPrefix(line, []byte("Linearized state matrices")) {
 			break
 		} else {
 
 			// Get first column as integer, skip line if not valid
-			rc, err := strconv.Atoi(fields[0])
-			if err != nil {
+			field, rest := nextField(line)
+			rc, err := strconv.Atoi(string(field))
+			if err != nil || currentOP == nil {
 				continue
 			}
 
-			op, err := strconv.ParseFloat(fields[1], 64)
-			if err != nil {
-				return nil, err
+			// Orientation operating points are written as three comma
+			// separated values, the first is the operating point
+			field, rest = nextField(rest)
+			var op float64
+			var orientation []float64
+			if bytes.HasSuffix(field, []byte(",")) {
+				orientation = make([]float64, 3)
+				for k := range orientation {
+					if k > 0 {
+						field, rest = nextField(rest)
+					}
+					if orientation[k], err = parseFloat(bytes.TrimSuffix(field, []byte(","))); err != nil {
+						return nil, lr.Errorf("error parsing operating point: %w", err)
+					}
+				}
+				op = orientation[0]
+			} else if op, err = parseFloat(field); err != nil {
+				return nil, lr.Errorf("error parsing operating point: %w", err)
 			}
 
-			isRotating, err := strconv.ParseBool(fields[2])
+			field, rest = nextField(rest)
+			isRotating, err := strconv.ParseBool(string(field))
 			if err != nil {
-				return nil, err
+				return nil, lr.Errorf("error parsing rotating frame flag: %w", err)
 			}
 
+			// Description follows the optional derivative order column
 			derivOrder := defaultDeriv
 			if hasDeriv {
-				derivOrder, err = strconv.Atoi(fields[3])
-				if err != nil {
-					return nil, err
+				field, rest = nextField(rest)
+				if derivOrder, err = strconv.Atoi(string(field)); err != nil {
+					return nil, lr.Errorf("error parsing derivative order: %w", err)
 				}
 			}
 
 			*currentOP = append(*currentOP, OperPointData{
-				RC:         rc,
-				OperPoint:  op,
-				IsRotating: isRotating,
-				DerivOrder: derivOrder,
-				Desc:       strings.Join(fields[4:], " "),
+				RC:          rc,
+				OperPoint:   op,
+				IsRotating:  isRotating,
+				DerivOrder:  derivOrder,
+				Desc:        strings.Join(strings.Fields(string(rest)), " "),
+				Orientation: orientation,
 			})
 		}
 	}
 
+	// Check table lengths against header counts, state derivative and
+	// constraint state tables aren't written by all versions of OpenFAST
+	for _, t := range []struct {
+		name     string
+		ops      []OperPointData
+		expected int
+		optional bool
+	}{
+		{"continuous states", linData.X, linData.NumX, false},
+		{"continuous state derivatives", linData.Xd, linData.NumX, true},
+		{"constraint states", linData.Z, linData.NumZ, true},
+		{"inputs", linData.U, linData.NumU, false},
+		{"outputs", linData.Y, linData.NumY, false},
+	} {
+		if len(t.ops) != t.expected && !(t.optional && len(t.ops) == 0) {
+			return nil, fmt.Errorf("%s: found %d %s, expected %d",
+				filePath, len(t.ops), t.name, t.expected)
+		}
+	}
+
 	// Sum number of second order continuous states
 	for _, op := range linData.X {
 		if op.DerivOrder == 2 {
@@ -183,52 +259,488 @@ func ReadLinData(filePath string) (*LinData, error) {
 	// State Matrices
 	//--------------------------------------------------------------------------
 
-	var matrix *mat.Dense
-	iRow := 0
-	for scanner.Scan() {
+	// Matrices are stored by the name preceding the dimensions, which must
+	// match the header counts
+	matrices := map[string]struct {
+		dst        **mat.Dense
+		rows, cols int
+	}{
+		"A":    {&linData.A, linData.NumX, linData.NumX},
+		"B":    {&linData.B, linData.NumX, linData.NumU},
+		"C":    {&linData.C, linData.NumY, linData.NumX},
+		"D":    {&linData.D, linData.NumY, linData.NumU},
+		"dUdu": {&linData.DUdu, linData.NumU, linData.NumU},
+		"dUdy": {&linData.DUdy, linData.NumU, linData.NumY},
+		"dXdy": {&linData.DXdy, linData.NumX, linData.NumY},
+	}
 
-		// Get line with whitespace removed
-		line := strings.TrimSpace(scanner.Text())
+	var matrix *mat.Dense
+	name := ""
+	numRows, iRow := 0, 0
+	for lr.Scan() {
 
-		// If nothing on line, continue
+		// Get line with whitespace removed, skip if empty
+		line := lr.Bytes()
 		if len(line) == 0 {
 			continue
 		}
 
-		fields := strings.Fields(line)
-		if len(fields) == 4 && fields[2] == "x" {
-			rows, _ := strconv.Atoi(fields[1])
-			cols, _ := strconv.Atoi(fields[3])
-			matrix = mat.NewDense(rows, cols, nil)
-			iRow = 0
-		}
-
-		// Switch based on beginning of line
-		switch line[0] {
-		case 'A':
-			linData.A = matrix
-		case 'B':
-			linData.B = matrix
-		case 'C':
-			linData.C = matrix
-		case 'D':
-			linData.D = matrix
-		default:
-			row := make([]float64, len(fields))
-			for i, s := range fields {
-				if row[i], err = strconv.ParseFloat(s, 64); err != nil {
-					return nil, err
-				}
+		// Matrix header (e.g. "dUdu:   10 x   10")
+		if rows, cols, header, ok := parseMatrixHeader(line); ok {
+			if iRow != numRows {
+				return nil, lr.Errorf("matrix %s has %d rows, expected %d", name, iRow, numRows)
+			}
+			name, numRows, iRow, matrix = header, rows, 0, nil
+			m, known := matrices[name]
+			if known && (rows != m.rows || cols != m.cols) {
+				return nil, lr.Errorf("matrix %s is %d x %d, expected %d x %d",
+					name, rows, cols, m.rows, m.cols)
+			}
+			if known && rows > 0 && cols > 0 {
+				matrix = mat.NewDense(rows, cols, nil)
+				*m.dst = matrix
+			}
+			continue
+		}
+
+		// Skip section titles (e.g. "Linearized state matrices:")
+		if line[len(line)-1] == ':' {
+			continue
+		}
+
+		if name == "" {
+			return nil, lr.Errorf("matrix data without matrix header")
+		}
+		if iRow >= numRows {
+			return nil, lr.Errorf("matrix %s has more than %d rows", name, numRows)
+		}
+		iRow++
+
+		// Skip rows of matrices which aren't stored
+		if matrix == nil {
+			continue
+		}
+
+		// Parse values directly into matrix row
+		raw := matrix.RawMatrix()
+		row := raw.Data[(iRow-1)*raw.Stride : (iRow-1)*raw.Stride+raw.Cols]
+		n := 0
+		for field, rest := nextField(line); len(field) > 0; field, rest = nextField(rest) {
+			if n == len(row) {
+				return nil, lr.Errorf("matrix %s row %d has more than %d values", name, iRow, len(row))
 			}
-			matrix.SetRow(iRow, row)
-			iRow++
+			if row[n], err = parseFloat(field); err != nil {
+				return nil, lr.Errorf("error parsing matrix %s row %d: %w", name, iRow, err)
+			}
+			n++
+		}
+		if n != len(row) {
+			return nil, lr.Errorf("matrix %s row %d has %d values, expected %d", name, iRow, n, len(row))
 		}
 	}
+	if iRow != numRows {
+		return nil, lr.Errorf("matrix %s has %d rows, expected %d", name, iRow, numRows)
+	}
 
-	// Get error from scanner
-	if err := scanner.Err(); err != nil {
+	// Get error from reader
+	if err := lr.Err(); err != nil {
 		return nil, err
 	}
 
 	return linData, nil
 }
+
+// linReaderBufSize is the buffer size of the linearization file reader.
+// Longer lines are accumulated in a separate buffer which is reused.
+var linReaderBufSize = 1 << 20
+
+// linReader reads lines of any length from a linearization file and tracks
+// the line number for errors. The interface follows bufio.Scanner.
+type linReader struct {
+	path string
+	r    *bufio.Reader
+	long []byte // Buffer for lines longer than the reader buffer
+	line []byte // Current line without leading/trailing whitespace
+	num  int    // Current line number
+	err  error
+}
+
+func newLinReader(r io.Reader, path string) *linReader {
+	return &linReader{path: path, r: bufio.NewReaderSize(r, linReaderBufSize)}
+}
+
+// Scan advances to the next line, returning false at the end of the file or
+// on error.
+func (lr *linReader) Scan() bool {
+	if lr.err != nil {
+		return false
+	}
+	line, err := lr.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		lr.long = append(lr.long[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = lr.r.ReadSlice('\n')
+			lr.long = append(lr.long, line...)
+		}
+		line = lr.long
+	}
+	if err != nil && err != io.EOF {
+		lr.err = lr.Errorf("%w", err)
+		return false
+	}
+	if len(line) == 0 {
+		return false
+	}
+	lr.num++
+	lr.line = bytes.TrimSpace(line)
+	return true
+}
+
+// Bytes returns the current line without leading/trailing whitespace. The
+// slice is only valid until the next call to Scan.
+func (lr *linReader) Bytes() []byte { return lr.line }
+
+// Text returns the current line without leading/trailing whitespace.
+func (lr *linReader) Text() string { return string(lr.line) }
+
+// Err returns the first read error.
+func (lr *linReader) Err() error { return lr.err }
+
+// Errorf returns an error prefixed with the file path and line number.
+func (lr *linReader) Errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("%s:%d: "+format, append([]interface{}{lr.path, lr.num}, a...)...)
+}
+
+// parseMatrixHeader parses a matrix header line (e.g. "A:   4 x   4") and
+// returns the dimensions and name, or ok=false if it isn't a header.
+func parseMatrixHeader(line []byte) (rows, cols int, name string, ok bool) {
+	field, rest := nextField(line)
+	if len(field) < 2 || field[len(field)-1] != ':' {
+		return 0, 0, "", false
+	}
+	rowsField, rest := nextField(rest)
+	xField, rest := nextField(rest)
+	colsField, rest := nextField(rest)
+	if extra, _ := nextField(rest); len(extra) > 0 || string(xField) != "x" {
+		return 0, 0, "", false
+	}
+	var err error
+	if rows, err = strconv.Atoi(string(rowsField)); err != nil || rows < 0 {
+		return 0, 0, "", false
+	}
+	if cols, err = strconv.Atoi(string(colsField)); err != nil || cols < 0 {
+		return 0, 0, "", false
+	}
+	return rows, cols, string(field[:len(field)-1]), true
+}
+
+// nextField returns the first whitespace delimited field in b and the
+// remainder of b. The field is empty if there are no more fields.
+func nextField(b []byte) (field, rest []byte) {
+	i := 0
+	for i < len(b) && isSpace(b[i]) {
+		i++
+	}
+	j := i
+	for j < len(b) && !isSpace(b[j]) {
+		j++
+	}
+	return b[i:j], b[j:]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// parseFloat parses a number. Fortran omits the exponent letter for three
+// digit exponents (e.g. 1.234567-100), which is handled.
+func parseFloat(b []byte) (float64, error) {
+	v, err := strconv.ParseFloat(string(b), 64)
+	if err == nil {
+		return v, nil
+	}
+	if i := bytes.LastIndexAny(b, "+-"); i > 0 && b[i-1] != 'E' && b[i-1] != 'e' {
+		fixed := make([]byte, 0, len(b)+1)
+		fixed = append(append(append(fixed, b[:i]...), 'E'), b[i:]...)
+		if v, err2 := strconv.ParseFloat(string(fixed), 64); err2 == nil {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid number '%s'", b)
+}
+
+// WriteLin writes the linearization data to a file in the OpenFAST text
+// linearization format, which can be read by ReadLinData and other tools
+// which read OpenFAST linearization files. Values are written with full
+// precision and orientation operating points as three values. Glue code
+// Jacobians are written if HasJacobians is set.
+func (ld *LinData) WriteLin(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ld.writeLin(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeLin writes the linearization data in the OpenFAST format to w.
+func (ld *LinData) writeLin(w io.Writer) error {
+
+	bw := bufio.NewWriter(w)
+
+	//--------------------------------------------------------------------------
+	// Header
+	//--------------------------------------------------------------------------
+
+	jacobians := "No"
+	if ld.HasJacobians {
+		jacobians = "Yes"
+	}
+	fmt.Fprintf(bw, "\nLinearized model: Predictions were generated by acdc\n\n")
+	fmt.Fprintf(bw, "Simulation information:\n")
+	fmt.Fprintf(bw, "   %-36s %24.16E s\n", "Simulation time:", ld.SimTime)
+	fmt.Fprintf(bw, "   %-36s %24.16E rad/s\n", "Rotor Speed:", ld.RotorSpeed)
+	fmt.Fprintf(bw, "   %-36s %24.16E rad\n", "Azimuth:", ld.Azimuth)
+	fmt.Fprintf(bw, "   %-36s %24.16E m/s\n", "Wind Speed:", ld.WindSpeed)
+	fmt.Fprintf(bw, "   %-36s %5d\n", "Number of continuous states:", ld.NumX)
+	fmt.Fprintf(bw, "   %-36s %5d\n", "Number of discrete states:", ld.NumXd)
+	fmt.Fprintf(bw, "   %-36s %5d\n", "Number of constraint states:", ld.NumZ)
+	fmt.Fprintf(bw, "   %-36s %5d\n", "Number of inputs:", ld.NumU)
+	fmt.Fprintf(bw, "   %-36s %5d\n", "Number of outputs:", ld.NumY)
+	fmt.Fprintf(bw, "   %-36s %5s\n", "Jacobians included in this file?", jacobians)
+
+	//--------------------------------------------------------------------------
+	// Operating points
+	//--------------------------------------------------------------------------
+
+	// State tables include the derivative order column, OpenFAST labels the
+	// index column of input tables "Column" and of output tables "Row"
+	for _, t := range []struct {
+		title    string
+		label    string
+		ops      []OperPointData
+		hasDeriv bool
+	}{
+		{"Order of continuous states:", "Row/Column", ld.X, true},
+		{"Order of continuous state derivatives:", "Row/Column", ld.Xd, true},
+		{"Order of constraint states:", "Row/Column", ld.Z, true},
+		{"Order of inputs:", "Column", ld.U, false},
+		{"Order of outputs:", "Row", ld.Y, false},
+	} {
+		if len(t.ops) == 0 {
+			continue
+		}
+		fmt.Fprintf(bw, "\n%s\n", t.title)
+		if t.hasDeriv {
+			fmt.Fprintf(bw, "   %10s         Operating Point   Rotating Frame?   Derivative Order   Description\n", t.label)
+			fmt.Fprintf(bw, "   ----------   ---------------------   ---------------   ----------------   -----------\n")
+		} else {
+			fmt.Fprintf(bw, "   %10s         Operating Point   Rotating Frame?   Description\n", t.label)
+			fmt.Fprintf(bw, "   ----------   ---------------------   ---------------   -----------\n")
+		}
+		for _, op := range t.ops {
+			rotating := "F"
+			if op.IsRotating {
+				rotating = "T"
+			}
+
+			// Orientations are written as three comma separated values
+			opStr := fmt.Sprintf("%24.16E", op.OperPoint)
+			if len(op.Orientation) == 3 {
+				opStr = fmt.Sprintf("%24.16E, %24.16E, %24.16E",
+					op.Orientation[0], op.Orientation[1], op.Orientation[2])
+			}
+
+			if t.hasDeriv {
+				fmt.Fprintf(bw, "   %10d   %s   %15s   %16d   %s\n",
+					op.RC, opStr, rotating, op.DerivOrder, op.Desc)
+			} else {
+				fmt.Fprintf(bw, "   %10d   %s   %15s   %s\n",
+					op.RC, opStr, rotating, op.Desc)
+			}
+		}
+	}
+
+	//--------------------------------------------------------------------------
+	// Matrices
+	//--------------------------------------------------------------------------
+
+	if ld.HasJacobians {
+		fmt.Fprintf(bw, "\nJacobian matrices:\n")
+		writeLinMatrix(bw, "dUdu", ld.DUdu)
+		writeLinMatrix(bw, "dUdy", ld.DUdy)
+		writeLinMatrix(bw, "dXdy", ld.DXdy)
+	}
+
+	fmt.Fprintf(bw, "\nLinearized state matrices:\n")
+	writeLinMatrix(bw, "A", ld.A)
+	writeLinMatrix(bw, "B", ld.B)
+	writeLinMatrix(bw, "C", ld.C)
+	writeLinMatrix(bw, "D", ld.D)
+
+	return bw.Flush()
+}
+
+// writeLinMatrix writes a matrix header and rows, nothing if m is nil.
+func writeLinMatrix(bw *bufio.Writer, name string, m *mat.Dense) {
+	if m == nil {
+		return
+	}
+	rows, cols := m.Dims()
+	fmt.Fprintf(bw, "\n%-8s %8d x %8d\n", name+":", rows, cols)
+	buf := []byte{}
+	for i := 0; i < rows; i++ {
+		buf = buf[:0]
+		for j := 0; j < cols; j++ {
+			// Align columns by leaving space for the sign
+			v := m.At(i, j)
+			buf = append(buf, ' ', ' ')
+			if !math.Signbit(v) {
+				buf = append(buf, ' ')
+			}
+			buf = strconv.AppendFloat(buf, v, 'E', 16, 64)
+		}
+		buf = append(buf, '\n')
+		bw.Write(buf)
+	}
+}
+
+// Relative tolerance for wind speed differences between the linearization
+// files of a condition
+const linSpeedTol = 0.01
+
+// Maximum number of mismatches reported by CheckLinData
+const maxLinMismatches = 20
+
+// CheckLinData checks that the linearization data from all files of a
+// condition are consistent with the first file: the same counts, matrix
+// dimensions, wind speed, rotor speed, and state, input, and output
+// descriptions, rotating frame flags, and derivative orders. Speeds must be
+// within linSpeedTol. Rotor speed changes across the files of start-up and
+// shutdown linearizations, so the expected rotor speed is extrapolated from
+// the first file using the simulation time and the rotor acceleration from
+// the state derivative operating points, or estimated from the rotor speeds
+// if they aren't available (see rotorAccelerations). Files with duplicate
+// azimuths are also reported, as they usually indicate stale files from a
+// previous run. The returned error lists each mismatch with the file and row.
+func CheckLinData(linData []*LinData) error {
+
+	if len(linData) == 0 {
+		return nil
+	}
+
+	mismatches := []string{}
+	addf := func(ld *LinData, format string, a ...interface{}) {
+		mismatches = append(mismatches, ld.FilePath+": "+fmt.Sprintf(format, a...))
+	}
+
+	ref := linData[0]
+	acc := rotorAccelerations(linData)
+	for k, ld := range linData[1:] {
+
+		// Counts
+		for _, c := range []struct {
+			name     string
+			got, ref int
+		}{
+			{"continuous states", ld.NumX, ref.NumX},
+			{"second order states", ld.NumX2, ref.NumX2},
+			{"discrete states", ld.NumXd, ref.NumXd},
+			{"constraint states", ld.NumZ, ref.NumZ},
+			{"inputs", ld.NumU, ref.NumU},
+			{"outputs", ld.NumY, ref.NumY},
+		} {
+			if c.got != c.ref {
+				addf(ld, "%d %s, expected %d", c.got, c.name, c.ref)
+			}
+		}
+		if ld.HasJacobians != ref.HasJacobians {
+			addf(ld, "Jacobians included = %v, expected %v", ld.HasJacobians, ref.HasJacobians)
+		}
+
+		// Wind speed
+		if math.Abs(ld.WindSpeed-ref.WindSpeed) > linSpeedTol*math.Max(math.Abs(ref.WindSpeed), 1) {
+			addf(ld, "wind speed %g, expected %g", ld.WindSpeed, ref.WindSpeed)
+		}
+
+		// Rotor speed, assuming the acceleration varies linearly in time
+		speed := ref.RotorSpeed + 0.5*(acc[0]+acc[k+1])*(ld.SimTime-ref.SimTime)
+		if math.Abs(ld.RotorSpeed-speed) > linSpeedTol*math.Max(math.Abs(speed), 1) {
+			addf(ld, "rotor speed %g rad/s, expected %g rad/s at time %g s", ld.RotorSpeed, speed, ld.SimTime)
+		}
+
+		// Matrix dimensions
+		for _, m := range []struct {
+			name     string
+			got, ref *mat.Dense
+		}{
+			{"A", ld.A, ref.A}, {"B", ld.B, ref.B}, {"C", ld.C, ref.C}, {"D", ld.D, ref.D},
+		} {
+			gr, gc, rr, rc := 0, 0, 0, 0
+			if m.got != nil {
+				gr, gc = m.got.Dims()
+			}
+			if m.ref != nil {
+				rr, rc = m.ref.Dims()
+			}
+			if gr != rr || gc != rc {
+				addf(ld, "matrix %s is %d x %d, expected %d x %d", m.name, gr, gc, rr, rc)
+			}
+		}
+
+		// Descriptions, rotating frame flags, and derivative orders
+		for _, t := range []struct {
+			name     string
+			got, ref []OperPointData
+		}{
+			{"state", ld.X, ref.X},
+			{"state derivative", ld.Xd, ref.Xd},
+			{"constraint state", ld.Z, ref.Z},
+			{"input", ld.U, ref.U},
+			{"output", ld.Y, ref.Y},
+		} {
+			if len(t.got) != len(t.ref) {
+				addf(ld, "%d %s descriptions, expected %d", len(t.got), t.name, len(t.ref))
+				continue
+			}
+			for i, op := range t.got {
+				r := t.ref[i]
+				switch {
+				case op.Desc != r.Desc:
+					addf(ld, "%s %d is '%s', expected '%s'", t.name, i+1, op.Desc, r.Desc)
+				case op.IsRotating != r.IsRotating:
+					addf(ld, "%s %d rotating frame = %v, expected %v", t.name, i+1, op.IsRotating, r.IsRotating)
+				case op.DerivOrder != r.DerivOrder:
+					addf(ld, "%s %d derivative order = %d, expected %d", t.name, i+1, op.DerivOrder, r.DerivOrder)
+				}
+			}
+		}
+	}
+
+	// Duplicate azimuths
+	for i, ld := range linData {
+		for _, other := range linData[:i] {
+			diff := math.Remainder(ld.Azimuth-other.Azimuth, 2*math.Pi)
+			if math.Abs(diff) < 1e-6 {
+				addf(ld, "azimuth %g rad duplicates %s", ld.Azimuth, other.FilePath)
+				break
+			}
+		}
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+	msg := fmt.Sprintf("linearization files are inconsistent with %s:", ref.FilePath)
+	for i, m := range mismatches {
+		if i == maxLinMismatches {
+			msg += fmt.Sprintf("\n  and %d more", len(mismatches)-i)
+			break
+		}
+		msg += "\n  " + m
+	}
+	return errors.New(msg)
+}
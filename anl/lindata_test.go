@@ -0,0 +1,442 @@
+package anl_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+// testLinFile is a linearization file with input, output, and constraint
+// state tables and glue code Jacobians. Table headers are labeled as written
+// by OpenFAST, where input and output tables have no derivative order column.
+const testLinFile = `
+Linearized model: Predictions were generated by OpenFAST (v3.5.0)
+                  Test linearization file
+
+Simulation information:
+  Simulation time:                    120.0000 s
+  Rotor Speed:                          1.2500 rad/s
+  Azimuth:                              0.5000 rad
+  Wind Speed:                          11.0000 m/s
+  Number of continuous states:         2
+  Number of discrete states:           0
+  Number of constraint states:         1
+  Number of inputs:                    2
+  Number of outputs:                   3
+  Jacobians included in this file?    Yes
+
+Order of continuous states:
+   Row/Column    Operating Point   Rotating Frame?  Derivative Order  Description
+   ----------   ---------------   ---------------  ----------------  -----------
+         1       1.000000E-01            F                2         ED Variable speed generator DOF (internal DOF index = DOF_GeAz), rad
+         2       1.250000E+00            F                2         ED First time derivative of Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s
+
+Order of continuous state derivatives:
+   Row/Column    Operating Point   Rotating Frame?  Derivative Order  Description
+   ----------   ---------------   ---------------  ----------------  -----------
+         1       1.250000E+00            F                2         ED First time derivative of Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s
+         2       0.000000E+00            F                2         ED Second time derivative of Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s^2
+
+Order of constraint states:
+   Row/Column    Operating Point   Rotating Frame?  Derivative Order  Description
+   ----------   ---------------   ---------------  ----------------  -----------
+         1       2.000000E+00            F                0         BD_1 Lagrange multiplier, N
+
+Order of inputs:
+     Column      Operating Point   Rotating Frame?  Description
+   ----------   ---------------   ---------------  -----------
+         1       5.000000E-02            T          ED Blade 1 pitch command, rad
+         2       4.000000E+04            F          ED Generator torque, Nm
+
+Order of outputs:
+        Row      Operating Point   Rotating Frame?  Description
+   ----------   ---------------   ---------------  -----------
+         1       1.200000E+01            F          ED RotSpeed, (rpm)
+         2       3.000000E+00            T          ED B1Pitch, (deg)
+         3       1.000000E+00,  0.000000E+00,  0.000000E+00            F          ED Hub orientation, -
+
+Jacobian matrices:
+
+dUdu:        2 x        2
+   1.000000E+00   0.000000E+00
+   0.000000E+00   1.000000E+00
+dUdy:        2 x        3
+   0.000000E+00  -5.000000E-01   0.000000E+00
+   0.000000E+00   0.000000E+00   0.000000E+00
+
+Linearized state matrices:
+
+A:        2 x        2
+   0.000000E+00   1.000000E+00
+  -2.000000E+00  -1.000000E-01
+B:        2 x        2
+   0.000000E+00   0.000000E+00
+  -3.000000E-01  -1.000000E-02
+C:        3 x        2
+   0.000000E+00   9.549297E+00
+   0.000000E+00   0.000000E+00
+   0.000000E+00   0.000000E+00
+D:        3 x        2
+   0.000000E+00   0.000000E+00
+   5.729578E+01   0.000000E+00
+   0.000000E+00   0.000000E+00
+`
+
+// writeLinFile writes the contents to a linearization file and returns the
+// path.
+func writeLinFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.1.lin")
+	if err := os.WriteFile(path, []byte(contents), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadLinData(t *testing.T) {
+
+	ld, err := anl.ReadLinData(writeLinFile(t, testLinFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ld.HasJacobians {
+		t.Error("HasJacobians = false, expected true")
+	}
+	if len(ld.X) != 2 || len(ld.Xd) != 2 || len(ld.Z) != 1 || len(ld.U) != 2 || len(ld.Y) != 3 {
+		t.Fatalf("table lengths X=%d, Xd=%d, Z=%d, U=%d, Y=%d, expected 2, 2, 1, 2, 3",
+			len(ld.X), len(ld.Xd), len(ld.Z), len(ld.U), len(ld.Y))
+	}
+	if ld.NumX2 != 2 {
+		t.Errorf("NumX2 = %d, expected 2", ld.NumX2)
+	}
+
+	// Input and output tables without derivative order column
+	if u := ld.U[0]; u.OperPoint != 0.05 || !u.IsRotating || u.DerivOrder != 0 || u.Desc != "ED Blade 1 pitch command, rad" {
+		t.Errorf("U[0] = %+v", u)
+	}
+	if y := ld.Y[1]; y.RC != 2 || y.OperPoint != 3 || !y.IsRotating || y.Desc != "ED B1Pitch, (deg)" {
+		t.Errorf("Y[1] = %+v", y)
+	}
+
+	// Orientation output with three comma separated operating point values
+	if y := ld.Y[2]; y.RC != 3 || y.OperPoint != 1 || y.IsRotating || y.Desc != "ED Hub orientation, -" ||
+		!reflect.DeepEqual(y.Orientation, []float64{1, 0, 0}) {
+		t.Errorf("Y[2] = %+v", y)
+	}
+	if z := ld.Z[0]; z.OperPoint != 2 || z.Desc != "BD_1 Lagrange multiplier, N" {
+		t.Errorf("Z[0] = %+v", z)
+	}
+
+	// Jacobians and state-space matrices
+	for _, m := range []struct {
+		name     string
+		got      *mat.Dense
+		i, j     int
+		expected float64
+	}{
+		{"dUdu", ld.DUdu, 1, 1, 1},
+		{"dUdy", ld.DUdy, 0, 1, -0.5},
+		{"A", ld.A, 1, 0, -2},
+		{"B", ld.B, 1, 1, -0.01},
+		{"C", ld.C, 0, 1, 9.549297},
+		{"D", ld.D, 1, 0, 57.29578},
+	} {
+		if m.got == nil {
+			t.Errorf("%s is nil", m.name)
+			continue
+		}
+		if v := m.got.At(m.i, m.j); v != m.expected {
+			t.Errorf("%s(%d,%d) = %v, expected %v", m.name, m.i, m.j, v, m.expected)
+		}
+	}
+	if ld.DXdy != nil {
+		t.Error("DXdy is not nil, expected nil")
+	}
+}
+
+func TestReadLinDataLongLines(t *testing.T) {
+
+	// Use a small reader buffer so rows span multiple buffers
+	defer func(size int) { *anl.LinReaderBufSize = size }(*anl.LinReaderBufSize)
+	*anl.LinReaderBufSize = 4096
+
+	numU := 2000
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, `Simulation information:
+  Number of continuous states:         1
+  Number of constraint states:         0
+  Number of inputs:                 %d
+  Number of outputs:                   0
+  Jacobians included in this file?    No
+
+Order of continuous states:
+   Row/Column    Operating Point   Rotating Frame?  Derivative Order  Description
+         1       1.000000E+00            F                1         ED State, -
+
+Order of inputs:
+     Column      Operating Point   Rotating Frame?  Description
+`, numU)
+	for i := 1; i <= numU; i++ {
+		fmt.Fprintf(sb, "%10d   0.000000E+00   F   Input %d, -\n", i, i)
+	}
+	fmt.Fprintf(sb, "\nLinearized state matrices:\n\nA:   1 x   1\n  -1.000000E+00\nB:   1 x %d\n", numU)
+	for i := 1; i <= numU; i++ {
+		fmt.Fprintf(sb, "  %15.6E", float64(i))
+	}
+	sb.WriteString("\n")
+
+	ld, err := anl.ReadLinData(writeLinFile(t, sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ld.U) != numU || ld.U[numU-1].Desc != fmt.Sprintf("Input %d, -", numU) {
+		t.Fatalf("read %d inputs, expected %d", len(ld.U), numU)
+	}
+	if _, c := ld.B.Dims(); c != numU {
+		t.Fatalf("B has %d columns, expected %d", c, numU)
+	}
+	for j := 0; j < numU; j++ {
+		if v := ld.B.At(0, j); v != float64(j+1) {
+			t.Fatalf("B(0,%d) = %v, expected %v", j, v, j+1)
+		}
+	}
+}
+
+func TestReadLinDataErrors(t *testing.T) {
+
+	// Parse errors are wrapped and don't reference the reader's buffer
+	_, err := anl.ReadLinData(writeLinFile(t, strings.Replace(testLinFile,
+		"5.000000E-02            T", "5.000000E-02            X", 1)))
+	numErr := &strconv.NumError{}
+	if !errors.As(err, &numErr) || numErr.Num != "X" {
+		t.Errorf("error '%v' doesn't wrap strconv.NumError for 'X'", err)
+	}
+
+	// lineOf returns the line number of the first line containing s
+	lineOf := func(contents, s string) int {
+		return strings.Count(contents[:strings.Index(contents, s)], "\n") + 1
+	}
+
+	for _, tc := range []struct {
+		name, old, new, errLine, errMsg string
+	}{
+		{"matrix dims", "B:        2 x        2", "B:        2 x        3",
+			"B:        2 x        3", "matrix B is 2 x 3, expected 2 x 2"},
+		{"short row", "  -3.000000E-01  -1.000000E-02", "  -3.000000E-01",
+			"  -3.000000E-01", "matrix B row 2 has 1 values, expected 2"},
+		{"missing row", "   5.729578E+01   0.000000E+00\n", "",
+			"", "matrix D has 2 rows, expected 3"},
+		{"bad number", "-2.000000E+00  -1.000000E-01", "-2.000000E+00  -1.0x0000E-01",
+			"-2.000000E+00  -1.0x0000E-01", "error parsing matrix A row 2"},
+		{"table length", "         2       3.000000E+00            T          ED B1Pitch, (deg)\n", "",
+			"", "found 2 outputs, expected 3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			contents := strings.Replace(testLinFile, tc.old, tc.new, 1)
+			path := writeLinFile(t, contents)
+			_, err := anl.ReadLinData(path)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("error '%v' doesn't contain '%s'", err, tc.errMsg)
+			}
+			if tc.errLine != "" {
+				prefix := fmt.Sprintf("%s:%d:", path, lineOf(contents, tc.errLine))
+				if !strings.HasPrefix(err.Error(), prefix) {
+					t.Errorf("error '%v' doesn't start with '%s'", err, prefix)
+				}
+			}
+		})
+	}
+}
+
+func TestReadLinDataFortranExponent(t *testing.T) {
+	contents := strings.Replace(testLinFile, "-2.000000E+00  -1.000000E-01", "-2.000000+100  -1.000000-101", 1)
+	ld, err := anl.ReadLinData(writeLinFile(t, contents))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := ld.A.At(1, 0); v != -2e100 {
+		t.Errorf("A(1,0) = %v, expected -2e100", v)
+	}
+	if v := ld.A.At(1, 1); v != -1e-101 {
+		t.Errorf("A(1,1) = %v, expected -1e-101", v)
+	}
+}
+
+func TestWriteLin(t *testing.T) {
+
+	orig, err := anl.ReadLinData(writeLinFile(t, testLinFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Synthetic system without Jacobians or constraint states
+	synth := newDrivetrainLinData(0.1, -0.2, -0.01)[1]
+	synth.SimTime = 10
+
+	for name, ld := range map[string]*anl.LinData{"file": orig, "synthetic": synth} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.lin")
+			if err := ld.WriteLin(path); err != nil {
+				t.Fatal(err)
+			}
+
+			// Input and output tables are labeled as in OpenFAST
+			contents, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, header := range []string{"Order of inputs:\n       Column ", "Order of outputs:\n          Row "} {
+				if !strings.Contains(string(contents), header) {
+					t.Errorf("missing table header %q", header)
+				}
+			}
+
+			got, err := anl.ReadLinData(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.SimTime != ld.SimTime || got.RotorSpeed != ld.RotorSpeed ||
+				got.Azimuth != ld.Azimuth || got.WindSpeed != ld.WindSpeed {
+				t.Errorf("header = %v, %v, %v, %v, expected %v, %v, %v, %v",
+					got.SimTime, got.RotorSpeed, got.Azimuth, got.WindSpeed,
+					ld.SimTime, ld.RotorSpeed, ld.Azimuth, ld.WindSpeed)
+			}
+			if got.NumX != ld.NumX || got.NumX2 != ld.NumX2 || got.NumZ != ld.NumZ ||
+				got.NumU != ld.NumU || got.NumY != ld.NumY || got.HasJacobians != ld.HasJacobians {
+				t.Errorf("counts = %+v, expected %+v", got, ld)
+			}
+
+			for _, tbl := range []struct {
+				name      string
+				got, want []anl.OperPointData
+			}{
+				{"X", got.X, ld.X}, {"Xd", got.Xd, ld.Xd}, {"Z", got.Z, ld.Z},
+				{"U", got.U, ld.U}, {"Y", got.Y, ld.Y},
+			} {
+				if len(tbl.got) != len(tbl.want) {
+					t.Errorf("%s has %d entries, expected %d", tbl.name, len(tbl.got), len(tbl.want))
+					continue
+				}
+				for i := range tbl.got {
+					if !reflect.DeepEqual(tbl.got[i], tbl.want[i]) {
+						t.Errorf("%s[%d] = %+v, expected %+v", tbl.name, i, tbl.got[i], tbl.want[i])
+					}
+				}
+			}
+
+			for _, m := range []struct {
+				name      string
+				got, want *mat.Dense
+			}{
+				{"A", got.A, ld.A}, {"B", got.B, ld.B}, {"C", got.C, ld.C}, {"D", got.D, ld.D},
+				{"dUdu", got.DUdu, ld.DUdu}, {"dUdy", got.DUdy, ld.DUdy}, {"dXdy", got.DXdy, ld.DXdy},
+			} {
+				if (m.got == nil) != (m.want == nil) {
+					t.Errorf("%s = %v, expected %v", m.name, m.got, m.want)
+				} else if m.got != nil && !mat.Equal(m.got, m.want) {
+					t.Errorf("%s = %v, expected %v", m.name, mat.Formatted(m.got), mat.Formatted(m.want))
+				}
+			}
+		})
+	}
+}
+
+func TestCheckLinData(t *testing.T) {
+
+	newLinData := func() []*anl.LinData {
+		linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+		for i, ld := range linData {
+			ld.FilePath = fmt.Sprintf("turb.%d.lin", i+1)
+		}
+		return linData
+	}
+
+	if err := anl.CheckLinData(newLinData()); err != nil {
+		t.Fatalf("unexpected error for consistent data: %v", err)
+	}
+
+	// Rotor speed changes during start-up and shutdown linearizations at the
+	// rate given by the generator velocity derivative
+	linData := newLinData()
+	for i, ld := range linData {
+		ld.SimTime = 10 + 0.5*float64(i)
+		ld.RotorSpeed = 1 + 0.1*float64(i)
+		ld.Xd = append([]anl.OperPointData{}, ld.X...)
+		ld.Xd[1].OperPoint = 0.2
+	}
+	if err := anl.CheckLinData(linData); err != nil {
+		t.Fatalf("unexpected error for varying rotor speed: %v", err)
+	}
+
+	// Without state derivatives the acceleration is estimated from the rotor
+	// speeds
+	for _, ld := range linData {
+		ld.Xd = nil
+	}
+	if err := anl.CheckLinData(linData); err != nil {
+		t.Fatalf("unexpected error for varying rotor speed without state derivatives: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		modify func(linData []*anl.LinData)
+		errMsg string
+	}{
+		{"description", func(linData []*anl.LinData) {
+			linData[2].U = append([]anl.OperPointData{}, linData[2].U...)
+			linData[2].U[3].Desc = "ED Generator torque command, Nm"
+		}, "turb.3.lin: input 4 is 'ED Generator torque command, Nm', expected 'ED Generator torque, Nm'"},
+		{"rotating flag", func(linData []*anl.LinData) {
+			linData[1].U = append([]anl.OperPointData{}, linData[1].U...)
+			linData[1].U[0].IsRotating = false
+		}, "turb.2.lin: input 1 rotating frame = false, expected true"},
+		{"counts", func(linData []*anl.LinData) {
+			linData[3].NumY = 2
+			linData[3].C = mat.NewDense(2, 2, nil)
+		}, "turb.4.lin: 2 outputs, expected 1"},
+		{"matrix dims", func(linData []*anl.LinData) {
+			linData[3].C = mat.NewDense(2, 2, nil)
+		}, "turb.4.lin: matrix C is 2 x 2, expected 1 x 2"},
+		{"wind speed", func(linData []*anl.LinData) {
+			linData[1].WindSpeed = 1.2
+		}, "turb.2.lin: wind speed 1.2, expected 0"},
+		{"rotor speed", func(linData []*anl.LinData) {
+			linData[2].RotorSpeed = 1.5
+		}, "turb.3.lin: rotor speed 1.5 rad/s, expected 1 rad/s"},
+		{"rotor acceleration", func(linData []*anl.LinData) {
+			for i, ld := range linData {
+				ld.SimTime = 10 + 0.5*float64(i)
+				ld.RotorSpeed = 1 + 0.1*float64(i)
+			}
+		}, "turb.2.lin: rotor speed 1.1 rad/s, expected 1 rad/s at time 10.5 s"},
+		{"duplicate azimuth", func(linData []*anl.LinData) {
+			linData[3].Azimuth = linData[1].Azimuth + 2*math.Pi
+		}, "turb.4.lin: azimuth"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			linData := newLinData()
+			tc.modify(linData)
+			err := anl.CheckLinData(linData)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("error '%v' doesn't contain '%s'", err, tc.errMsg)
+			}
+		})
+	}
+}
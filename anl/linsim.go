@@ -0,0 +1,248 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// SimResults contains the results of a time-domain simulation of a linear
+// model. States and outputs are perturbations about the operating point in
+// MBC ordering.
+type SimResults struct {
+	Time        []float64   // Simulation time (s)
+	Azimuth     []float64   // Rotor azimuth at each time (rad)
+	StateNames  []string    // Names of state channels
+	OutputNames []string    // Names of output channels
+	States      [][]float64 // State values at each time
+	Outputs     [][]float64 // Output values at each time
+}
+
+// Simulate integrates the model with fourth order Runge-Kutta at the given
+// times from the initial state x0 and rotor azimuth psi0 (rad). The azimuth
+// advances with the model's mean rotor speed. The inputs u are given at each
+// time and are interpolated linearly between times. If x0 is nil, the initial
+// state is zero and if u is nil, the inputs are zero.
+func (pm *PeriodicModel) Simulate(time []float64, x0 []float64, u [][]float64, psi0 float64) (*SimResults, error) {
+
+	// Validate arguments
+	if pm.NumStates == 0 {
+		return nil, fmt.Errorf("model has no states")
+	}
+	if len(time) == 0 {
+		return nil, fmt.Errorf("no simulation times")
+	}
+	for i, t := range time {
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			return nil, fmt.Errorf("simulation time[%d] = %v is not finite", i, t)
+		}
+	}
+	for i := 1; i < len(time); i++ {
+		if time[i] <= time[i-1] {
+			return nil, fmt.Errorf("simulation times must be increasing, time[%d] = %v <= time[%d] = %v",
+				i, time[i], i-1, time[i-1])
+		}
+	}
+	if x0 != nil && len(x0) != pm.NumStates {
+		return nil, fmt.Errorf("initial state has %d values, expected %d", len(x0), pm.NumStates)
+	}
+	if u != nil {
+		if pm.B == nil && pm.D == nil {
+			return nil, fmt.Errorf("inputs given but model has no input matrices")
+		}
+		if len(u) != len(time) {
+			return nil, fmt.Errorf("inputs given at %d times, expected %d", len(u), len(time))
+		}
+		for i, ui := range u {
+			if len(ui) != pm.NumInputs {
+				return nil, fmt.Errorf("inputs at time[%d] have %d values, expected %d", i, len(ui), pm.NumInputs)
+			}
+		}
+	}
+
+	sr := &SimResults{
+		Time:        time,
+		Azimuth:     make([]float64, len(time)),
+		StateNames:  channelNames(pm.DescStates, pm.NumStates, "State"),
+		OutputNames: channelNames(pm.DescOutputs, pm.NumOutputs, "Output"),
+		States:      make([][]float64, len(time)),
+		Outputs:     make([][]float64, len(time)),
+	}
+
+	// Input vector at time index, zero if no inputs given
+	input := func(i int) *mat.VecDense {
+		if u == nil || pm.NumInputs == 0 {
+			return nil
+		}
+		return mat.NewVecDense(pm.NumInputs, append([]float64{}, u[i]...))
+	}
+
+	// State and input matrices at time t
+	matrices := func(t float64) (A, B *mat.Dense) {
+		psi := psi0 + pm.Omega*(t-time[0])
+		return pm.A.At(psi), pm.B.At(psi)
+	}
+
+	// State derivative, xd = A(psi)*x + B(psi)*u
+	deriv := func(A, B *mat.Dense, x, ut *mat.VecDense) *mat.VecDense {
+		xd := mat.NewVecDense(pm.NumStates, nil)
+		xd.MulVec(A, x)
+		if B != nil && ut != nil {
+			bu := mat.NewVecDense(pm.NumStates, nil)
+			bu.MulVec(B, ut)
+			xd.AddVec(xd, bu)
+		}
+		return xd
+	}
+
+	x := mat.NewVecDense(pm.NumStates, nil)
+	if x0 != nil {
+		x.CopyVec(mat.NewVecDense(len(x0), x0))
+	}
+
+	// Matrices at the start of each step are those from the end of the
+	// previous step, so A and B are only evaluated at the midpoint and end
+	A0, B0 := matrices(time[0])
+
+	for i, t := range time {
+
+		// Save state and outputs at this time
+		sr.Azimuth[i] = psi0 + pm.Omega*(t-time[0])
+		sr.States[i] = vecToSlice(x)
+		sr.Outputs[i] = pm.outputs(sr.Azimuth[i], x, input(i))
+
+		if i == len(time)-1 {
+			break
+		}
+
+		// Runge-Kutta step to the next time with inputs interpolated at the
+		// midpoint of the step
+		h := time[i+1] - t
+		u0, u2 := input(i), input(i+1)
+		var u1 *mat.VecDense
+		if u0 != nil {
+			u1 = mat.NewVecDense(pm.NumInputs, nil)
+			u1.AddVec(u0, u2)
+			u1.ScaleVec(0.5, u1)
+		}
+		A1, B1 := matrices(t + h/2)
+		A2, B2 := matrices(t + h)
+		k1 := deriv(A0, B0, x, u0)
+		k2 := deriv(A1, B1, addScaledVec(x, h/2, k1), u1)
+		k3 := deriv(A1, B1, addScaledVec(x, h/2, k2), u1)
+		k4 := deriv(A2, B2, addScaledVec(x, h, k3), u2)
+		x.AddScaledVec(x, h/6, k1)
+		x.AddScaledVec(x, h/3, k2)
+		x.AddScaledVec(x, h/3, k3)
+		x.AddScaledVec(x, h/6, k4)
+		A0, B0 = A2, B2
+	}
+
+	return sr, nil
+}
+
+// SimulateStep simulates the response from zero initial state to a step of
+// the given amplitude in one input applied at the first time.
+func (pm *PeriodicModel) SimulateStep(time []float64, input int, amplitude, psi0 float64) (*SimResults, error) {
+	if input < 0 || input >= pm.NumInputs {
+		return nil, fmt.Errorf("input %d out of range [0, %d)", input, pm.NumInputs)
+	}
+	u := make([][]float64, len(time))
+	for i := range u {
+		u[i] = make([]float64, pm.NumInputs)
+		u[i][input] = amplitude
+	}
+	return pm.Simulate(time, nil, u, psi0)
+}
+
+// SimulateImpulse simulates the response to a unit impulse in one input at
+// the first time. The impulse is applied as the initial state B(psi0) times
+// the input unit vector, so the impulse through the feedthrough matrix is not
+// included in the outputs.
+func (pm *PeriodicModel) SimulateImpulse(time []float64, input int, psi0 float64) (*SimResults, error) {
+	if input < 0 || input >= pm.NumInputs {
+		return nil, fmt.Errorf("input %d out of range [0, %d)", input, pm.NumInputs)
+	}
+	if pm.B == nil {
+		return nil, fmt.Errorf("model has no input matrix")
+	}
+	_, B, _, _ := pm.At(psi0)
+	return pm.Simulate(time, mat.Col(nil, input, B), nil, psi0)
+}
+
+// SimulateMode simulates the free decay of a mode from the initial state given
+// by the real part of its eigenvector. Second order velocities are derived
+// from the displacements and the eigenvalue.
+func (pm *PeriodicModel) SimulateMode(time []float64, mode *ModeResults, psi0 float64) (*SimResults, error) {
+	if len(mode.EigenVector) != pm.NumDOF2+pm.NumDOF1 {
+		return nil, fmt.Errorf("mode eigenvector has %d values, expected %d",
+			len(mode.EigenVector), pm.NumDOF2+pm.NumDOF1)
+	}
+	x0 := make([]float64, pm.NumStates)
+	for i := 0; i < pm.NumDOF2; i++ {
+		x0[i] = real(mode.EigenVector[i])
+		x0[pm.NumDOF2+i] = real(mode.EigenValue * mode.EigenVector[i])
+	}
+	for i := 0; i < pm.NumDOF1; i++ {
+		x0[2*pm.NumDOF2+i] = real(mode.EigenVector[pm.NumDOF2+i])
+	}
+	return pm.Simulate(time, x0, nil, psi0)
+}
+
+// outputs returns the outputs y = C(psi)*x + D(psi)*u, or nil if the model
+// has no output matrices.
+func (pm *PeriodicModel) outputs(psi float64, x, u *mat.VecDense) []float64 {
+	if pm.NumOutputs == 0 || (pm.C == nil && pm.D == nil) {
+		return nil
+	}
+	C, D := pm.C.At(psi), pm.D.At(psi)
+	y := mat.NewVecDense(pm.NumOutputs, nil)
+	if C != nil {
+		y.MulVec(C, x)
+	}
+	if D != nil && u != nil {
+		du := mat.NewVecDense(pm.NumOutputs, nil)
+		du.MulVec(D, u)
+		y.AddVec(y, du)
+	}
+	return vecToSlice(y)
+}
+
+// TimeSeries returns evenly spaced times from zero to the duration inclusive
+// with the given step. The step must be positive and the duration must be
+// finite and not negative.
+func TimeSeries(duration, step float64) ([]float64, error) {
+	if !(step > 0) || math.IsInf(step, 0) {
+		return nil, fmt.Errorf("time step must be positive and finite, got %v", step)
+	}
+	if !(duration >= 0) || math.IsInf(duration, 0) {
+		return nil, fmt.Errorf("duration must be finite and not negative, got %v", duration)
+	}
+	n := int(math.Round(duration/step)) + 1
+	time := make([]float64, n)
+	for i := range time {
+		time[i] = float64(i) * step
+	}
+	return time, nil
+}
+
+// channelNames returns the descriptions of the channels, or generic names
+// with the prefix if the descriptions are not available.
+func channelNames(desc []OperPointData, n int, prefix string) []string {
+	if len(desc) == n {
+		return descriptions(desc)
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s %d", prefix, i+1)
+	}
+	return names
+}
+
+// addScaledVec returns a + alpha*b as a new vector.
+func addScaledVec(a *mat.VecDense, alpha float64, b *mat.VecDense) *mat.VecDense {
+	v := mat.NewVecDense(a.Len(), nil)
+	v.AddScaledVec(a, alpha, b)
+	return v
+}
@@ -0,0 +1,198 @@
+package anl_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestSimulate(t *testing.T) {
+
+	// Initial condition response of the averaged model matches the matrix
+	// exponential of the fixed frame state matrix
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := anl.NewAveragedModel(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time, err := anl.TimeSeries(2, 0.005)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x0 := make([]float64, md.NumStates)
+	x0[0], x0[3] = 1, -0.5
+	sr, err := pm.Simulate(time, x0, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expA := &mat.Dense{}
+	tmp := &mat.Dense{}
+	tmp.Scale(time[len(time)-1], ts.A)
+	expA.Exp(tmp)
+	exp := mat.NewVecDense(md.NumStates, nil)
+	exp.MulVec(expA, mat.NewVecDense(len(x0), x0))
+	assertMatEqual(t, "x(T)", mat.NewVecDense(md.NumStates, sr.States[len(time)-1]), exp, 1e-8)
+
+	expY := mat.NewVecDense(md.NumOutputs, nil)
+	expY.MulVec(ts.C, exp)
+	assertMatEqual(t, "y(T)", mat.NewVecDense(md.NumOutputs, sr.Outputs[len(time)-1]), expY, 1e-8)
+
+	// Output names from output descriptions in MBC ordering
+	if len(sr.OutputNames) != md.NumOutputs {
+		t.Fatalf("got %d output names, expected %d", len(sr.OutputNames), md.NumOutputs)
+	}
+	for i, name := range sr.OutputNames {
+		if name != md.DescOutputs[i].Desc {
+			t.Errorf("OutputNames[%d] = %q, expected %q", i, name, md.DescOutputs[i].Desc)
+		}
+	}
+
+	// Invalid arguments
+	if _, err := pm.Simulate(time, x0[:2], nil, 0); err == nil {
+		t.Error("expected error for wrong initial state length")
+	}
+	if _, err := pm.Simulate([]float64{0, 1, 1}, nil, nil, 0); err == nil {
+		t.Error("expected error for non-increasing times")
+	}
+	if _, err := pm.SimulateStep(time, md.NumInputs, 1, 0); err == nil {
+		t.Error("expected error for input out of range")
+	}
+}
+
+func TestSimulateStepImpulse(t *testing.T) {
+
+	// First order system x' = -x + 2u, y = 3x + 0.5u
+	linData := make([]*anl.LinData, 4)
+	for i := range linData {
+		linData[i] = &anl.LinData{
+			Azimuth:    math.Pi / 2 * float64(i),
+			RotorSpeed: 1,
+			NumX:       1,
+			NumU:       1,
+			NumY:       1,
+			X:          []anl.OperPointData{{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"}},
+			U:          []anl.OperPointData{{RC: 1, Desc: "IfW Extended input: horizontal wind speed (steady/uniform wind), m/s"}},
+			Y:          []anl.OperPointData{{RC: 1, Desc: "ED GenSpeed, (rpm)"}},
+			A:          mat.NewDense(1, 1, []float64{-1}),
+			B:          mat.NewDense(1, 1, []float64{2}),
+			C:          mat.NewDense(1, 1, []float64{3}),
+			D:          mat.NewDense(1, 1, []float64{0.5}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := anl.NewPeriodicModel(md, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time, err := anl.TimeSeries(3, 0.01)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sr, err := pm.SimulateStep(time, 0, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sr.OutputNames[0] != "ED GenSpeed, (rpm)" {
+		t.Fatalf("OutputNames[0] = %q", sr.OutputNames[0])
+	}
+	for i, ti := range time {
+		exp := 3*2*(1-math.Exp(-ti)) + 0.5
+		if math.Abs(sr.Outputs[i][0]-exp) > 1e-8 {
+			t.Fatalf("step output at t=%v is %v, expected %v", ti, sr.Outputs[i][0], exp)
+		}
+	}
+	if exp := time[len(time)-1]; math.Abs(sr.Azimuth[len(time)-1]-exp) > 1e-12 {
+		t.Fatalf("final azimuth = %v, expected %v", sr.Azimuth[len(time)-1], exp)
+	}
+
+	sr, err = pm.SimulateImpulse(time, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ti := range time {
+		exp := 2 * math.Exp(-ti)
+		if math.Abs(sr.States[i][0]-exp) > 1e-8 {
+			t.Fatalf("impulse state at t=%v is %v, expected %v", ti, sr.States[i][0], exp)
+		}
+	}
+}
+
+func TestSimulateMode(t *testing.T) {
+
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := anl.NewAveragedModel(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Free decay of a mode follows the real part of exp(ev*t)*v
+	mode := md.Modes[len(md.Modes)-1]
+	time, err := anl.TimeSeries(1, 0.005)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr, err := pm.SimulateMode(time, mode, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ti := range time {
+		scale := complex(math.Exp(real(mode.EigenValue)*ti), 0) *
+			complex(math.Cos(imag(mode.EigenValue)*ti), math.Sin(imag(mode.EigenValue)*ti))
+		for j := 0; j < md.NumDOF2; j++ {
+			exp := real(scale * mode.EigenVector[j])
+			if math.Abs(sr.States[i][j]-exp) > 1e-8 {
+				t.Fatalf("state %d at t=%v is %v, expected %v", j, ti, sr.States[i][j], exp)
+			}
+		}
+	}
+}
+
+func TestSimulateInvalid(t *testing.T) {
+
+	for _, tc := range []struct{ duration, step float64 }{
+		{1, 0}, {1, -0.1}, {1, math.NaN()}, {math.Inf(1), 0.1}, {-1, 0.1},
+	} {
+		if _, err := anl.TimeSeries(tc.duration, tc.step); err == nil {
+			t.Errorf("TimeSeries(%v, %v) did not return an error", tc.duration, tc.step)
+		}
+	}
+
+	// Model without states
+	if _, err := (&anl.PeriodicModel{}).Simulate([]float64{0, 1}, nil, nil, 0); err == nil {
+		t.Error("Simulate of model without states did not return an error")
+	}
+
+	// Times which aren't finite
+	ts := newTestSystem(3, 1.2, []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2})
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := anl.NewAveragedModel(md)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pm.Simulate([]float64{0, 1, math.Inf(1)}, nil, nil, 0); err == nil {
+		t.Error("Simulate with infinite time did not return an error")
+	}
+}
@@ -0,0 +1,182 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// PeriodicModel is a linear time-periodic (LTP) state-space model in MBC
+// ordering. The state-space matrices are represented by Fourier series in
+// rotor azimuth fit to the sampled matrices so they can be evaluated at any
+// azimuth.
+type PeriodicModel struct {
+	NumHarmonics int
+	NumStates    int
+	NumDOF2      int
+	NumDOF1      int
+	NumInputs    int
+	NumOutputs   int
+	Omega        float64 // Mean rotor speed (rad/s)
+	DescStates   []OperPointData
+	DescInputs   []OperPointData
+	DescOutputs  []OperPointData
+	A, B, C, D   *FourierMatrix
+}
+
+// FourierMatrix is a matrix valued Fourier series in azimuth,
+// M(psi) = Mean + sum_k Cos[k-1]*cos(k*psi) + Sin[k-1]*sin(k*psi).
+type FourierMatrix struct {
+	Mean     *mat.Dense
+	Cos, Sin []*mat.Dense
+}
+
+// NewPeriodicModel fits Fourier series with the given number of harmonics to
+// the MBC state-space matrices sampled at each azimuth. The series are fit by
+// least squares so the azimuths don't need to be evenly spaced. If
+// numHarmonics is negative, the maximum number of harmonics resolved by the
+// azimuth samples is used. A, B, C, and D are nil if they weren't in the
+// linearization data.
+func NewPeriodicModel(md *MatData, numHarmonics int) (*PeriodicModel, error) {
+
+	// Number of harmonics is limited by the number of samples
+	maxHarmonics := (md.NumStep - 1) / 2
+	if numHarmonics < 0 {
+		numHarmonics = maxHarmonics
+	}
+	if numHarmonics > maxHarmonics {
+		return nil, fmt.Errorf("%d harmonics requested but %d azimuth samples only resolve %d",
+			numHarmonics, md.NumStep, maxHarmonics)
+	}
+
+	qr := fourierBasisQR(md.Azimuth, numHarmonics)
+
+	pm := &PeriodicModel{
+		NumHarmonics: numHarmonics,
+		NumStates:    md.NumStates,
+		NumDOF2:      md.NumDOF2,
+		NumDOF1:      md.NumDOF1,
+		NumInputs:    md.NumInputs,
+		NumOutputs:   md.NumOutputs,
+		Omega:        mat.Sum(md.Omega) / float64(md.NumStep),
+		DescStates:   md.DescStates,
+		DescInputs:   md.DescInputs,
+		DescOutputs:  md.DescOutputs,
+	}
+
+	var err error
+	if pm.A, err = fitFourierMatrix(qr, numHarmonics, md.A); err != nil {
+		return nil, fmt.Errorf("error fitting A: %w", err)
+	}
+	if pm.B, err = fitFourierMatrix(qr, numHarmonics, md.B); err != nil {
+		return nil, fmt.Errorf("error fitting B: %w", err)
+	}
+	if pm.C, err = fitFourierMatrix(qr, numHarmonics, md.C); err != nil {
+		return nil, fmt.Errorf("error fitting C: %w", err)
+	}
+	if pm.D, err = fitFourierMatrix(qr, numHarmonics, md.D); err != nil {
+		return nil, fmt.Errorf("error fitting D: %w", err)
+	}
+
+	return pm, nil
+}
+
+// NewAveragedModel creates a constant model from the azimuth averaged MBC
+// state-space matrices, equivalent to a periodic model with no harmonics.
+func NewAveragedModel(md *MatData) (*PeriodicModel, error) {
+	return NewPeriodicModel(md, 0)
+}
+
+// At returns the state-space matrices at the given azimuth (rad). Matrices
+// which weren't in the linearization data are nil.
+func (pm *PeriodicModel) At(psi float64) (A, B, C, D *mat.Dense) {
+	return pm.A.At(psi), pm.B.At(psi), pm.C.At(psi), pm.D.At(psi)
+}
+
+// At evaluates the Fourier series at the given azimuth (rad). Returns nil if
+// the series is nil.
+func (fm *FourierMatrix) At(psi float64) *mat.Dense {
+	if fm == nil {
+		return nil
+	}
+	m := mat.DenseCopyOf(fm.Mean)
+	tmp := &mat.Dense{}
+	for k := range fm.Cos {
+		s, c := math.Sincos(float64(k+1) * psi)
+		tmp.Scale(c, fm.Cos[k])
+		m.Add(m, tmp)
+		tmp.Scale(s, fm.Sin[k])
+		m.Add(m, tmp)
+	}
+	return m
+}
+
+// fourierBasisQR returns the QR factorization of the Fourier basis with the
+// given number of harmonics evaluated at each azimuth (deg), which is used to
+// fit Fourier series to matrices sampled at those azimuths.
+func fourierBasisQR(azimuth *mat.VecDense, numHarmonics int) *mat.QR {
+	basis := mat.NewDense(azimuth.Len(), 2*numHarmonics+1, nil)
+	for i := 0; i < azimuth.Len(); i++ {
+		psi := azimuth.AtVec(i) * math.Pi / 180
+		basis.Set(i, 0, 1)
+		for k := 1; k <= numHarmonics; k++ {
+			s, c := math.Sincos(float64(k) * psi)
+			basis.Set(i, 2*k-1, c)
+			basis.Set(i, 2*k, s)
+		}
+	}
+	qr := &mat.QR{}
+	qr.Factorize(basis)
+	return qr
+}
+
+// fitFourierMatrix solves for the Fourier coefficients of the matrices
+// sampled at each azimuth given the QR factorization of the Fourier basis.
+// Returns nil if there are no matrices, as for a model without inputs.
+func fitFourierMatrix(qr *mat.QR, numHarmonics int, ms []*mat.Dense) (*FourierMatrix, error) {
+
+	if len(ms) == 0 {
+		return nil, nil
+	}
+
+	r, c := ms[0].Dims()
+
+	// Each row of the right hand side is a flattened sample matrix
+	rhs := mat.NewDense(len(ms), r*c, nil)
+	for i, m := range ms {
+		for j := 0; j < r; j++ {
+			for k := 0; k < c; k++ {
+				rhs.Set(i, j*c+k, m.At(j, k))
+			}
+		}
+	}
+
+	coefs := &mat.Dense{}
+	if err := qr.SolveTo(coefs, false, rhs); err != nil {
+		return nil, err
+	}
+
+	// Unflatten coefficients into matrices
+	unflatten := func(row int) *mat.Dense {
+		m := mat.NewDense(r, c, nil)
+		for j := 0; j < r; j++ {
+			for k := 0; k < c; k++ {
+				m.Set(j, k, coefs.At(row, j*c+k))
+			}
+		}
+		return m
+	}
+
+	fm := &FourierMatrix{
+		Mean: unflatten(0),
+		Cos:  make([]*mat.Dense, numHarmonics),
+		Sin:  make([]*mat.Dense, numHarmonics),
+	}
+	for k := 0; k < numHarmonics; k++ {
+		fm.Cos[k] = unflatten(2*k + 1)
+		fm.Sin[k] = unflatten(2*k + 2)
+	}
+
+	return fm, nil
+}
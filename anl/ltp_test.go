@@ -0,0 +1,77 @@
+package anl_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestPeriodicModel(t *testing.T) {
+
+	// System constant in the fixed frame evaluates to the same matrices at
+	// any azimuth
+	azimuths := []float64{0, 0.7, 1.9, 3.1, 4.4}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := anl.NewPeriodicModel(md, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.NumHarmonics != 2 {
+		t.Fatalf("NumHarmonics = %d, expected 2", pm.NumHarmonics)
+	}
+	if math.Abs(pm.Omega-1.2) > 1e-12 {
+		t.Fatalf("Omega = %v, expected 1.2", pm.Omega)
+	}
+	for _, psi := range []float64{0.3, 2.5, 5.9} {
+		A, B, C, D := pm.At(psi)
+		assertMatEqual(t, "A", A, ts.A, 1e-10)
+		assertMatEqual(t, "B", B, ts.B, 1e-10)
+		assertMatEqual(t, "C", C, ts.C, 1e-10)
+		assertMatEqual(t, "D", D, ts.D, 1e-10)
+	}
+
+	// Periodic state matrix is interpolated between azimuth samples
+	aFunc := func(psi float64) float64 {
+		return -1 + 0.5*math.Cos(psi) - 0.2*math.Sin(2*psi)
+	}
+	linData := make([]*anl.LinData, 6)
+	for i := range linData {
+		psi := 2 * math.Pi * float64(i) / float64(len(linData))
+		linData[i] = &anl.LinData{
+			Azimuth:    psi,
+			RotorSpeed: 0.8,
+			NumX:       1,
+			X: []anl.OperPointData{
+				{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"},
+			},
+			A: mat.NewDense(1, 1, []float64{aFunc(psi)}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	if md, err = anl.CollectMatrixData(linData, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pm, err = anl.NewPeriodicModel(md, 2); err != nil {
+		t.Fatal(err)
+	}
+	for _, psi := range []float64{0.3, 2.5, 5.9} {
+		A, B, _, _ := pm.At(psi)
+		if act, exp := A.At(0, 0), aFunc(psi); math.Abs(act-exp) > 1e-12 {
+			t.Errorf("A(%v) = %v, expected %v", psi, act, exp)
+		}
+		if B != nil {
+			t.Errorf("B(%v) = %v, expected nil", psi, B)
+		}
+	}
+
+	// Harmonics not resolved by the samples
+	if _, err := anl.NewPeriodicModel(md, 3); err == nil {
+		t.Fatal("expected error for too many harmonics")
+	}
+}
@@ -14,29 +14,41 @@ import (
 )
 
 type MatData struct {
-	LinData    []*LinData
-	NumStep    int
-	NumStates  int
-	NumStates2 int
-	NumInputs  int
-	NumOutputs int
-	NumDOF1    int
-	NumDOF2    int
-	Azimuth    *mat.VecDense
-	Omega      *mat.VecDense
-	OmegaDot   *mat.VecDense
-	WindSpeed  *mat.VecDense
-	A, B, C, D []*mat.Dense
-	OpX        []*mat.VecDense
-	OpXd       []*mat.VecDense
-	AvgA       *mat.Dense
-	AvgOpX     *mat.VecDense
-	AvgOpXd    *mat.VecDense
-	Rotation   RotationTriplets
-	Modes      []*ModeResults
+	LinData     []*LinData
+	NumStep     int
+	NumBlades   int
+	NumStates   int
+	NumStates2  int
+	NumInputs   int
+	NumOutputs  int
+	NumDOF1     int
+	NumDOF2     int
+	Azimuth     *mat.VecDense
+	Omega       *mat.VecDense
+	OmegaDot    *mat.VecDense
+	WindSpeed   *mat.VecDense
+	A, B, C, D  []*mat.Dense
+	OpX         []*mat.VecDense
+	OpXd        []*mat.VecDense
+	AvgA        *mat.Dense
+	AvgB        *mat.Dense
+	AvgC        *mat.Dense
+	AvgD        *mat.Dense
+	AvgOpX      *mat.VecDense
+	AvgOpXd     *mat.VecDense
+	Rotation    RotationTriplets
+	DescStates  []OperPointData // State descriptions in MBC ordering
+	DescInputs  []OperPointData // Input descriptions in MBC ordering
+	DescOutputs []OperPointData // Output descriptions in MBC ordering
+	ModeStates  []OperPointData // Descriptions of mode eigenvector rows in MBC ordering
+	Modes       []*ModeResults
+	Floquet     *FloquetResults
+	Periodicity *PeriodicityResults
+	ClosedLoop  *ClosedLoopResults
 }
 
 type RotationTriplets struct {
+	OrderStates     []int // Linearization file index of each state in displacement, velocity, first order ordering
 	TripletsStates2 [][]int
 	PermuteStates2  []int
 	TripletsStates1 [][]int
@@ -47,7 +59,13 @@ type RotationTriplets struct {
 	PermuteOutputs  []int
 }
 
-func collectMatrixData(linData []*LinData) (*MatData, error) {
+// collectMatrixData combines the linearization data from each azimuth into
+// matrix data and performs the multi-blade coordinate transformation. If
+// numBlades is less than one, it is inferred from the blade descriptions.
+// Rotating states which aren't associated with a blade, such as the ElastoDyn
+// teeter DOF of a two-bladed rotor, remain in the rotating frame. Azimuth
+// steps are transformed concurrently by up to numWorkers goroutines.
+func collectMatrixData(linData []*LinData, numBlades, numWorkers int) (*MatData, error) {
 
 	var err error
 
@@ -62,6 +80,12 @@ func collectMatrixData(linData []*LinData) (*MatData, error) {
 	// Use last linearization data for initialization
 	initData := linData[numSteps-1]
 
+	// Check dimensions before transforming, as CheckLinData may not have
+	// been called
+	if err := checkStepDims(linData, initData); err != nil {
+		return nil, err
+	}
+
 	// Create MBC structure
 	md := &MatData{
 		NumStep:    numSteps,
@@ -69,7 +93,7 @@ func collectMatrixData(linData []*LinData) (*MatData, error) {
 		NumStates:  initData.NumX,
 		NumStates2: initData.NumX2,
 		NumDOF1:    initData.NumX - initData.NumX2,
-		NumDOF2:    initData.NumX - initData.NumX2/2,
+		NumDOF2:    initData.NumX2 / 2,
 		NumInputs:  initData.NumU,
 		NumOutputs: initData.NumY,
 		Azimuth:    mat.NewVecDense(numSteps, nil),
@@ -80,6 +104,7 @@ func collectMatrixData(linData []*LinData) (*MatData, error) {
 	}
 
 	// If number of states is greater than zero
+	var orderedX []OperPointData
 	if md.NumStates > 0 {
 
 		// Create slice of vectors
@@ -98,211 +123,174 @@ func collectMatrixData(linData []*LinData) (*MatData, error) {
 		md.AvgOpX = mat.NewVecDense(md.NumStates, nil)
 		md.AvgOpXd = mat.NewVecDense(md.NumStates, nil)
 
+		// Order states as all displacements, all velocities, and then all first
+		// order states, because OpenFAST writes the states module by module
+		md.Rotation.OrderStates, err = stateOrdering(initData.X)
+		if err != nil {
+			return nil, err
+		}
+		orderedX = orderedOperPoints(initData.X, md.Rotation.OrderStates)
+
 		// Find blade triplets
-		md.Rotation.TripletsStates2 = findBladeTriplets(initData.X[:md.NumDOF2])
-		md.Rotation.TripletsStates1 = findBladeTriplets(initData.X[:md.NumDOF1])
+		md.Rotation.TripletsStates2 = findBladeTriplets(orderedX[:md.NumDOF2])
+		md.Rotation.TripletsStates1 = findBladeTriplets(orderedX[md.NumStates2:])
+	}
 
-		// Find permutations
-		md.Rotation.PermuteStates2, err = tripletsToPermutations(md.NumDOF2, md.Rotation.TripletsStates2)
+	// If inputs have been read, find input triplets
+	hasInputDesc := md.NumInputs > 0 && len(initData.U) == md.NumInputs
+	if hasInputDesc {
+		md.Rotation.TripletsInputs = findBladeTriplets(initData.U)
+	}
+
+	// If outputs have been read, find output triplets
+	hasOutputDesc := md.NumOutputs > 0 && len(initData.Y) == md.NumOutputs
+	if hasOutputDesc {
+		md.Rotation.TripletsOutputs = findBladeTriplets(initData.Y)
+	}
+
+	// If number of blades wasn't specified, get it from the blade triplets
+	if numBlades <= 0 {
+		numBlades = numBladesFromTriplets(md.Rotation.TripletsStates2,
+			md.Rotation.TripletsStates1, md.Rotation.TripletsInputs,
+			md.Rotation.TripletsOutputs)
+	}
+	md.NumBlades = numBlades
+
+	// Find permutations
+	if md.NumStates > 0 {
+		md.Rotation.PermuteStates2, err = tripletsToPermutations(md.NumDOF2,
+			numBlades, md.Rotation.TripletsStates2)
 		if err != nil {
 			return nil, err
 		}
 
-		md.Rotation.PermuteStates1, err = tripletsToPermutations(md.NumDOF1, md.Rotation.TripletsStates1)
+		// First order state row/column numbers start after the second order states
+		md.Rotation.PermuteStates1, err = tripletsToPermutations(md.NumDOF1,
+			numBlades, offsetTriplets(md.Rotation.TripletsStates1, -md.NumStates2))
 		if err != nil {
 			return nil, err
 		}
 	}
-
-	numBlades := 3
+	if hasInputDesc {
+		md.Rotation.PermuteInputs, err = tripletsToPermutations(md.NumInputs,
+			numBlades, md.Rotation.TripletsInputs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		md.Rotation.PermuteInputs = identityPermutation(md.NumInputs)
+	}
+	if hasOutputDesc {
+		md.Rotation.PermuteOutputs, err = tripletsToPermutations(md.NumOutputs,
+			numBlades, md.Rotation.TripletsOutputs)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		md.Rotation.PermuteOutputs = identityPermutation(md.NumOutputs)
+	}
 
 	numFixFrameStates2 := md.NumDOF2 - len(md.Rotation.TripletsStates2)*numBlades
 	numFixFrameStates1 := md.NumDOF1 - len(md.Rotation.TripletsStates1)*numBlades
 	numFixFrameInputs := md.NumInputs - len(md.Rotation.TripletsInputs)*numBlades
-	numFixFrameoutputs := md.NumOutputs - len(md.Rotation.TripletsOutputs)*numBlades
+	numFixFrameOutputs := md.NumOutputs - len(md.Rotation.TripletsOutputs)*numBlades
 
 	// Get state permutation slice
-	permuteStates := md.Rotation.PermuteStates2
+	permuteStates := make([]int, 0, md.NumStates)
+	permuteStates = append(permuteStates, md.Rotation.PermuteStates2...)
 	for _, v := range md.Rotation.PermuteStates2 {
 		permuteStates = append(permuteStates, v+md.NumDOF2)
 	}
 	for _, v := range md.Rotation.PermuteStates1 {
 		permuteStates = append(permuteStates, v+md.NumStates2)
 	}
-	P := mat.NewDense(len(permuteStates), len(permuteStates), nil)
-	P.Permutation(len(permuteStates), permuteStates)
 
-	// Loop through linearization data
-	for i, ld := range linData {
+	// Map state permutation to linearization file ordering
+	for i, v := range permuteStates {
+		permuteStates[i] = md.Rotation.OrderStates[v]
+	}
 
-		// Rotor speed in radians/sec and rotor speed squared
-		omega := ld.RotorSpeed
-		omega2 := omega * omega
-		omegaDot := 0.0
-
-		md.Omega.SetVec(i, omega)
-		md.OmegaDot.SetVec(i, omegaDot)
-		md.Azimuth.SetVec(i, ld.Azimuth*180/math.Pi)
-		md.WindSpeed.SetVec(i, ld.WindSpeed)
-
-		cosCol := make([]float64, numBlades)
-		sinCol := make([]float64, numBlades)
-		cosColNeg := make([]float64, numBlades)
-		sinColNeg := make([]float64, numBlades)
-
-		for i := 0; i < numBlades; i++ {
-			az := ld.Azimuth + 2*math.Pi*float64(i)/float64(numBlades)
-			sinCol[i], cosCol[i] = math.Sincos(az)
-			sinColNeg[i] = -sinCol[i]
-			cosColNeg[i] = -cosCol[i]
-		}
-
-		ones := NewOnesVec(numBlades)
-
-		// Eq. 9, t_tilde
-		tt := mat.NewDense(3, numBlades, nil)
-		tt.SetCol(0, ones)
-		tt.SetCol(1, cosCol)
-		tt.SetCol(2, sinCol)
-
-		// t_tilde inverse
-		c1, c2, c3 := cosCol[0], cosCol[1], cosCol[2]
-		s1, s2, s3 := sinCol[0], sinCol[1], sinCol[2]
-		ttv := mat.NewDense(3, 3, []float64{
-			c2*s3 - s2*c3, c3*s1 - s3*c1, c1*s2 - s1*c2,
-			s2 - s3, s3 - s1, s1 - s2,
-			c3 - c2, c1 - c3, c2 - c1,
-		})
-		ttv.Scale(1/(1.5*math.Sqrt(3)), ttv)
-
-		// Eq. 16 a, t_tilde_2
-		tt2 := mat.NewDense(3, numBlades, nil)
-		tt2.SetCol(1, sinColNeg)
-		tt2.SetCol(2, cosCol)
-
-		// Eq. 16 b, t_tilde_3
-		tt3 := mat.NewDense(3, numBlades, nil)
-		tt3.SetCol(1, cosColNeg)
-		tt3.SetCol(2, sinColNeg)
-
-		// Eq. 11 for second-order states only
-		T1 := blockDiag(eye(numFixFrameStates2),
-			Repeat(tt, len(md.Rotation.TripletsStates2))...)
-
-		// Inverse of T1
-		T1v := blockDiag(eye(numFixFrameStates2),
-			Repeat(ttv, len(md.Rotation.TripletsStates2))...)
-
-		// Eq. 14  for second-order states only
-		T2 := blockDiag(mat.NewDense(numFixFrameStates2, numFixFrameStates2, nil),
-			Repeat(tt2, len(md.Rotation.TripletsStates2))...)
-		T2_omega := &mat.Dense{}
-		T2_omega.Scale(omega, T2)
-		T2_2omega := &mat.Dense{}
-		T2_2omega.Scale(2*omega, T2)
-
-		// Eq. 11 for first-order states (eq. 8 in MBC3 Update document)
-		T1q := blockDiag(eye(numFixFrameStates1),
-			Repeat(tt, len(md.Rotation.TripletsStates1))...)
-
-		// Inverse of T1q
-		T1qv := blockDiag(eye(numFixFrameStates1),
-			Repeat(ttv, len(md.Rotation.TripletsStates1))...)
-
-		// Eq. 14 for first-order states (eq.  9 in MBC3 Update document)
-		T2q_omega := &mat.Dense{}
-		if numFixFrameStates1 > 0 {
-			T2q := blockDiag(mat.NewDense(numFixFrameStates1, numFixFrameStates1, nil),
-				Repeat(tt2, len(md.Rotation.TripletsStates1))...)
-			T2q_omega.Scale(omega, T2q)
-		}
-
-		// Eq. 15
-		T3 := blockDiag(mat.NewDense(numFixFrameStates2, numFixFrameStates2, nil),
-			Repeat(tt3, len(md.Rotation.TripletsStates2))...)
-		T3_omega2 := &mat.Dense{}
-		T3_omega2.Scale(omega2, T3)
-
-		T1c := &mat.Dense{}
-		if numFixFrameInputs > 0 {
-			T1c = blockDiag(eye(numFixFrameInputs),
-				Repeat(tt, len(md.Rotation.TripletsInputs))...)
-		}
-
-		// Inverse of T1q
-		T1ov := &mat.Dense{}
-		if numFixFrameoutputs > 0 {
-			T1ov = blockDiag(eye(numFixFrameoutputs),
-				Repeat(ttv, len(md.Rotation.TripletsOutputs))...)
-		}
-
-		_ = T1c
-		_ = T1ov
-
-		// Copy A matrix from linearization data
-		A := &mat.Dense{}
-		A.CloneFrom(ld.A)
-		A.Mul(P, A)
-		A.Mul(A, P)
-
-		L := blockDiag(T1, T1, T1q)
-		L.Slice(0, md.NumDOF2, md.NumDOF2, md.NumStates2).(*mat.Dense).Scale(omega, T2)
-
-		R := blockDiag(T2_omega, T2_2omega, T2q_omega)
-		tmp1, tmp2 := &mat.Dense{}, &mat.Dense{}
-		tmp1.Scale(omega2, T3)
-		tmp2.Scale(omegaDot, T2)
-		R.Slice(0, md.NumDOF2, md.NumDOF2, md.NumStates2).(*mat.Dense).Add(tmp1, tmp2)
-
-		AL := &mat.Dense{}
-		AL.Mul(A, L)
-		ALmR := &mat.Dense{}
-		ALmR.Sub(AL, R)
-
-		ANR := &mat.Dense{}
-		ANR.Mul(blockDiag(T1v, T1v, T1qv), ALmR)
-		ANR.Mul(P, ANR)
-		ANR.Mul(ANR, P)
-
-		md.A[i] = ANR
-
-		if false {
-			toCSV(tt, "mat-tt.csv")
-			toCSV(ttv, "mat-ttv.csv")
-			toCSV(tt2, "mat-tt2.csv")
-			toCSV(tt3, "mat-tt3.csv")
-			toCSV(T1, "mat-T1.csv")
-			toCSV(T1v, "mat-T1v.csv")
-			toCSV(T2, "mat-T2.csv")
-			toCSV(T1q, "mat-T1q.csv")
-			toCSV(T1qv, "mat-T1qv.csv")
-			toCSV(T1q, "mat-T1q.csv")
-			toCSV(T2q_omega, "mat-T2q.csv")
-			toCSV(T3, "mat-T3.csv")
-			toCSV(T1c, "mat-T1c.csv")
-			toCSV(T1ov, "mat-T1ov.csv")
-			toCSV(L, "mat-L.csv")
-			toCSV(R, "mat-R.csv")
-			toCSV(A, "mat-A.csv")
-			toCSV(ANR, "mat-ANR.csv")
-		}
-
-		// for j, opx := range ld.X {
-		// 	md.OpX[i].SetVec(j, opx.OperPoint)
-		// }
-
-		// for j, opxd := range ld.Xd {
-		// 	md.OpXd[i].SetVec(j, opxd.OperPoint)
-		// }
-
-		// Reorder A, opx, opxd
-	}
-
-	// Average the A matrix
-	for _, A := range md.A {
-		md.AvgA.Add(md.AvgA, A)
-	}
-	md.AvgA.Scale(1/float64(len(md.A)), md.AvgA)
+	// Descriptions of states, inputs, and outputs in MBC ordering
+	if md.NumStates > 0 {
+		md.DescStates = append(md.DescStates, mbcOperPoints(orderedX,
+			md.Rotation.PermuteStates2, numFixFrameStates2, numBlades)...)
+		md.DescStates = append(md.DescStates, mbcOperPoints(orderedX[md.NumDOF2:],
+			md.Rotation.PermuteStates2, numFixFrameStates2, numBlades)...)
+		md.DescStates = append(md.DescStates, mbcOperPoints(orderedX[md.NumStates2:],
+			md.Rotation.PermuteStates1, numFixFrameStates1, numBlades)...)
+	}
+	if hasInputDesc {
+		md.DescInputs = mbcOperPoints(initData.U, md.Rotation.PermuteInputs,
+			numFixFrameInputs, numBlades)
+	}
+	if hasOutputDesc {
+		md.DescOutputs = mbcOperPoints(initData.Y, md.Rotation.PermuteOutputs,
+			numFixFrameOutputs, numBlades)
+	}
+
+	// Get rotating frame operating points, unwrapping angles so they can be
+	// transformed and averaged across azimuth steps
+	opXRot, opXdRot := rotatingOperPoints(linData, md.NumStates)
+
+	// Allocate input and output matrices if present in linearization data
+	hasB := initData.B != nil && md.NumStates > 0 && md.NumInputs > 0
+	hasC := initData.C != nil && md.NumStates > 0 && md.NumOutputs > 0
+	hasD := initData.D != nil && md.NumInputs > 0 && md.NumOutputs > 0
+	if hasB {
+		md.B = make([]*mat.Dense, numSteps)
+		md.AvgB = mat.NewDense(md.NumStates, md.NumInputs, nil)
+	}
+	if hasC {
+		md.C = make([]*mat.Dense, numSteps)
+		md.AvgC = mat.NewDense(md.NumOutputs, md.NumStates, nil)
+	}
+	if hasD {
+		md.D = make([]*mat.Dense, numSteps)
+		md.AvgD = mat.NewDense(md.NumOutputs, md.NumInputs, nil)
+	}
+
+	// Rotor acceleration at each azimuth
+	omegaDots := rotorAccelerations(linData)
+
+	// Transform each azimuth step into the nonrotating frame
+	if err := newMBCBlocks(md, permuteStates).transformSteps(md, numWorkers, omegaDots, opXRot, opXdRot); err != nil {
+		return nil, err
+	}
+
+	// Sum the state space matrices in azimuth order so the averages don't
+	// depend on the order in which steps were transformed
+	for i := range linData {
+		if md.NumStates > 0 {
+			md.AvgA.Add(md.AvgA, md.A[i])
+		}
+		if hasB {
+			md.AvgB.Add(md.AvgB, md.B[i])
+		}
+		if hasC {
+			md.AvgC.Add(md.AvgC, md.C[i])
+		}
+		if hasD {
+			md.AvgD.Add(md.AvgD, md.D[i])
+		}
+	}
+
+	// Average the state space matrices
+	if hasB {
+		md.AvgB.Scale(1/float64(numSteps), md.AvgB)
+	}
+	if hasC {
+		md.AvgC.Scale(1/float64(numSteps), md.AvgC)
+	}
+	if hasD {
+		md.AvgD.Scale(1/float64(numSteps), md.AvgD)
+	}
+
+	// Models without states, such as those with only feedthrough from inputs
+	// to outputs, have no operating points or modes
+	if md.NumStates == 0 {
+		return md, nil
+	}
+	md.AvgA.Scale(1/float64(numSteps), md.AvgA)
 
 	// Average X operating points
 	for _, op := range md.OpX {
@@ -316,71 +304,155 @@ func collectMatrixData(linData []*LinData) (*MatData, error) {
 	}
 	md.AvgOpXd.ScaleVec(1/float64(len(md.OpXd)), md.AvgOpXd)
 
+	// Eigenvector rows to keep in mode shapes
+	vecRows := modeRows(md)
+
+	// Descriptions of eigenvector rows
+	if len(md.DescStates) == md.NumStates {
+		md.ModeStates = make([]OperPointData, 0, len(vecRows))
+		for _, r := range vecRows {
+			md.ModeStates = append(md.ModeStates, md.DescStates[r])
+		}
+	}
+
 	// Eigenvalue/eigenvector analysis
+	if md.Modes, err = modesFromEigen(md, md.AvgA, vecRows); err != nil {
+		return nil, err
+	}
+
+	return md, nil
+}
+
+// modesFromEigen performs eigenanalysis of the state matrix A and returns the
+// mode results for real eigenvalues and one eigenvalue of each complex
+// conjugate pair, sorted by natural frequency.
+func modesFromEigen(md *MatData, A mat.Matrix, vecRows []int) ([]*ModeResults, error) {
+
 	eig := mat.Eigen{}
-	if ok := eig.Factorize(md.AvgA, mat.EigenRight); !ok {
+	if ok := eig.Factorize(A, mat.EigenRight); !ok {
 		return nil, fmt.Errorf("error computing eigenvalues")
 	}
 	eigvecs := &mat.CDense{}
 	eig.VectorsTo(eigvecs)
 
-	// Eigenvector columns to keep based on degrees of freedom
-	vecRows := []int{}
+	n, _ := A.Dims()
+	var modes []*ModeResults
+	for i, ev := range eig.Values(nil) {
+		if imag(ev) >= 0 {
+			eigvec := make([]complex128, n)
+			for r := range eigvec {
+				eigvec[r] = eigvecs.At(r, i)
+			}
+			modes = append(modes, newModeResults(md, ev, eigvec, vecRows))
+		}
+	}
+
+	sortModes(modes)
+	return modes, nil
+}
+
+// sortModes sorts modes by natural frequency.
+func sortModes(modes []*ModeResults) {
+	sort.SliceStable(modes, func(i, j int) bool {
+		return modes[i].NaturalFreqRaw < modes[j].NaturalFreqRaw
+	})
+}
+
+// modeRows returns the eigenvector rows to keep in mode shapes, the
+// displacements of second order states (velocities are redundant) and all
+// first order states.
+func modeRows(md *MatData) []int {
+	rows := make([]int, 0, md.NumDOF2+md.NumDOF1)
 	for i := 0; i < md.NumDOF2; i++ {
-		vecRows = append(vecRows, i)
+		rows = append(rows, i)
 	}
-	for i := 2*md.NumDOF2 + 1; i < md.NumStates; i++ {
-		vecRows = append(vecRows, i)
+	for i := md.NumStates2; i < md.NumStates; i++ {
+		rows = append(rows, i)
 	}
+	return rows
+}
 
-	// Collect mode results
-	for i, ev := range eig.Values(nil) {
-		if imag(ev) > 0 {
-
-			evAbs := cmplx.Abs(ev)
-
-			// Create mode
-			mode := &ModeResults{
-				EigenValue:     ev,
-				NaturalFreqRaw: evAbs,
-				NaturalFreqHz:  evAbs / (2 * math.Pi),
-				DampedFreqRaw:  imag(ev),
-				DampedFreqHz:   imag(ev) / (2 * math.Pi),
-				DampingRatio:   -real(ev) / evAbs,
-				EigenVector:    make([]complex128, len(vecRows)),
-				Magnitudes:     make([]float64, len(vecRows)),
-				Phases:         make([]float64, len(vecRows)),
-				Shape:          make([]float64, len(vecRows)),
-			}
+// newModeResults creates the results for a mode from the eigenvalue and the
+// full eigenvector in MBC ordering. The mode shape contains the eigenvector
+// rows given by vecRows.
+func newModeResults(md *MatData, ev complex128, eigvec []complex128, vecRows []int) *ModeResults {
 
-			// Extract relevant eigenvector values
-			for j, r := range vecRows {
-				v := eigvecs.At(r, i)
-				mode.EigenVector[j] = v
-				mode.Magnitudes[j] = cmplx.Abs(v)
-				mode.Phases[j] = cmplx.Phase(v) * 180 / math.Pi
-			}
+	evAbs := cmplx.Abs(ev)
 
-			// Normalize magnitudes to get mode shape
-			maxMag := mode.Magnitudes[0]
-			for _, m := range mode.Magnitudes {
-				if math.Abs(m) > math.Abs(maxMag) {
-					maxMag = m
-				}
-			}
-			for j, m := range mode.Magnitudes {
-				mode.Shape[j] = m / maxMag
-			}
+	// Damping ratio is undefined for zero eigenvalues
+	dampingRatio := 0.0
+	if evAbs > 0 {
+		dampingRatio = -real(ev) / evAbs
+	}
 
-			// Add mode to slice of modes
-			md.Modes = append(md.Modes, mode)
-		}
+	// Create mode
+	mode := &ModeResults{
+		Type:           modeType(ev),
+		EigenValue:     ev,
+		NaturalFreqRaw: evAbs,
+		NaturalFreqHz:  evAbs / (2 * math.Pi),
+		DampedFreqRaw:  imag(ev),
+		DampedFreqHz:   imag(ev) / (2 * math.Pi),
+		DampingRatio:   dampingRatio,
+		EigenVector:    make([]complex128, len(vecRows)),
+		Magnitudes:     make([]float64, len(vecRows)),
+		Phases:         make([]float64, len(vecRows)),
+		Shape:          make([]float64, len(vecRows)),
 	}
 
-	return md, nil
+	// Extract relevant eigenvector values
+	for j, r := range vecRows {
+		v := eigvec[r]
+		mode.EigenVector[j] = v
+		mode.Magnitudes[j] = cmplx.Abs(v)
+		mode.Phases[j] = cmplx.Phase(v) * 180 / math.Pi
+	}
+
+	// Phase aligned mode shape normalized by states with the same units
+	mode.ShapeComplex = normalizeShape(md.ModeStates, mode.EigenVector)
+	for j, v := range mode.ShapeComplex {
+		mode.Shape[j] = cmplx.Abs(v)
+	}
+
+	// Whirl decomposition of blade triplets
+	mode.Whirl = bladeWhirl(md, eigvec)
+
+	// Name mode from the dominant states in the eigenvector
+	mode.Name = modeName(md.ModeStates, mode.EigenVector)
+
+	return mode
+}
+
+// Mode types based on the eigenvalue
+const (
+	ModeOscillatory = "oscillatory" // Stable complex eigenvalue
+	ModeOverdamped  = "overdamped"  // Stable real eigenvalue
+	ModeRigidBody   = "rigid-body"  // Zero eigenvalue
+	ModeUnstable    = "unstable"    // Eigenvalue with positive real part
+)
+
+// Eigenvalue magnitude (rad/s) below which modes are considered rigid-body
+const rigidBodyTol = 1e-6
+
+// modeType returns the type of mode based on the eigenvalue.
+func modeType(ev complex128) string {
+	switch {
+	case cmplx.Abs(ev) < rigidBodyTol:
+		return ModeRigidBody
+	case real(ev) > 0:
+		return ModeUnstable
+	case imag(ev) != 0:
+		return ModeOscillatory
+	default:
+		return ModeOverdamped
+	}
 }
 
+// ModeResults contains the eigenanalysis results for a mode. The rows of the
+// eigenvector and shape slices are described by MatData.ModeStates.
 type ModeResults struct {
+	Name           string
+	Type           string
 	EigenValue     complex128
 	NaturalFreqRaw float64
 	NaturalFreqHz  float64
@@ -391,15 +463,255 @@ type ModeResults struct {
 	Magnitudes     []float64
 	Phases         []float64
 	Shape          []float64
+	ShapeComplex   []complex128
+	Whirl          []WhirlResults
+	PeriodicShapes [][]complex128 // Floquet mode shape at each azimuth
 }
 
-func tripletsToPermutations(ndof int, triplets [][]int) ([]int, error) {
+// checkStepDims checks that the state, input, and output counts, operating
+// point tables, and state-space matrix dimensions of each linearization match
+// the reference linearization used to build the transformation.
+func checkStepDims(linData []*LinData, ref *LinData) error {
+
+	for i, ld := range linData {
+
+		errorf := func(format string, a ...interface{}) error {
+			return fmt.Errorf("error in linearization %d at azimuth %.2f deg from '%s': %s",
+				i+1, ld.Azimuth*180/math.Pi, ld.FilePath, fmt.Sprintf(format, a...))
+		}
+
+		// Counts
+		for _, c := range []struct {
+			name     string
+			got, ref int
+		}{
+			{"continuous states", ld.NumX, ref.NumX},
+			{"second order states", ld.NumX2, ref.NumX2},
+			{"inputs", ld.NumU, ref.NumU},
+			{"outputs", ld.NumY, ref.NumY},
+		} {
+			if c.got != c.ref {
+				return errorf("%d %s, expected %d", c.got, c.name, c.ref)
+			}
+		}
+
+		// State operating points, state derivatives are optional
+		if ref.NumX > 0 && len(ld.X) != ref.NumX {
+			return errorf("%d state operating points, expected %d", len(ld.X), ref.NumX)
+		}
+		if len(ld.Xd) != 0 && len(ld.Xd) != ref.NumX {
+			return errorf("%d state derivative operating points, expected %d", len(ld.Xd), ref.NumX)
+		}
+
+		// Matrices used in the transformation
+		for _, m := range []struct {
+			name       string
+			m          *mat.Dense
+			used       bool
+			rows, cols int
+		}{
+			{"A", ld.A, ref.NumX > 0, ref.NumX, ref.NumX},
+			{"B", ld.B, ref.B != nil && ref.NumX > 0 && ref.NumU > 0, ref.NumX, ref.NumU},
+			{"C", ld.C, ref.C != nil && ref.NumX > 0 && ref.NumY > 0, ref.NumY, ref.NumX},
+			{"D", ld.D, ref.D != nil && ref.NumU > 0 && ref.NumY > 0, ref.NumY, ref.NumU},
+		} {
+			if !m.used {
+				continue
+			}
+			if m.m == nil {
+				return errorf("matrix %s is missing", m.name)
+			}
+			if r, c := m.m.Dims(); r != m.rows || c != m.cols {
+				return errorf("matrix %s is %d x %d, expected %d x %d", m.name, r, c, m.rows, m.cols)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rotatingOperPoints returns the state and state derivative operating points
+// for each azimuth step. States with angular units are unwrapped across steps
+// so values near +/-pi don't produce discontinuities.
+func rotatingOperPoints(linData []*LinData, numStates int) (opX, opXd []*mat.VecDense) {
+
+	opX = make([]*mat.VecDense, len(linData))
+	opXd = make([]*mat.VecDense, len(linData))
+	if numStates == 0 {
+		return opX, opXd
+	}
+
+	for i, ld := range linData {
+		opX[i] = mat.NewVecDense(numStates, nil)
+		opXd[i] = mat.NewVecDense(numStates, nil)
+		for j, op := range ld.X {
+			opX[i].SetVec(j, op.OperPoint)
+		}
+		for j, op := range ld.Xd {
+			opXd[i].SetVec(j, op.OperPoint)
+		}
+	}
+
+	// Unwrap angular displacement states
+	for j, op := range linData[0].X {
+		if !isAngle(op.Desc) {
+			continue
+		}
+		for i := 1; i < len(opX); i++ {
+			prev, curr := opX[i-1].AtVec(j), opX[i].AtVec(j)
+			opX[i].SetVec(j, curr-2*math.Pi*math.Round((curr-prev)/(2*math.Pi)))
+		}
+	}
+
+	return opX, opXd
+}
+
+// stateOrdering returns the linearization file index of each state when the
+// states are ordered as all second order displacements, then all second order
+// velocities, and then all first order states, as in getStateOrderingIndx of
+// MBC3. OpenFAST writes the states of each module together, with a module's
+// displacements followed by its velocities, so the second order states of
+// ElastoDyn and BeamDyn are interleaved. Each run of second order states from
+// the same module instance is split in half into displacements and velocities.
+func stateOrdering(x []OperPointData) ([]int, error) {
+
+	var q, qd, x1 []int
+	for start := 0; start < len(x); {
+
+		// Find the end of the run of states from this module with the same
+		// derivative order
+		cd := ParseDesc(x[start].Desc)
+		end := start + 1
+		for ; end < len(x) && x[end].DerivOrder == x[start].DerivOrder; end++ {
+			next := ParseDesc(x[end].Desc)
+			if next.Module != cd.Module || next.Instance != cd.Instance {
+				break
+			}
+		}
+
+		if x[start].DerivOrder != 2 {
+			for i := start; i < end; i++ {
+				x1 = append(x1, i)
+			}
+			start = end
+			continue
+		}
+
+		n := end - start
+		if n%2 != 0 {
+			return nil, fmt.Errorf("module of state %d (%s) has %d consecutive second order states, expected an even number",
+				start+1, x[start].Desc, n)
+		}
+		for i := start; i < start+n/2; i++ {
+			q = append(q, i)
+			qd = append(qd, i+n/2)
+		}
+		start = end
+	}
+
+	order := make([]int, 0, len(x))
+	order = append(order, q...)
+	order = append(order, qd...)
+	order = append(order, x1...)
+	return order, nil
+}
+
+// orderedOperPoints returns the operating point data in the given order with
+// the row/column numbers renumbered to match.
+func orderedOperPoints(ops []OperPointData, order []int) []OperPointData {
+	out := make([]OperPointData, len(order))
+	for i, j := range order {
+		out[i] = ops[j]
+		out[i].RC = i + 1
+	}
+	return out
+}
+
+// rotorAccelerations returns the rotor acceleration (rad/s^2) for each
+// linearization. The acceleration is taken from the state derivative operating
+// points of the ElastoDyn generator azimuth and drivetrain torsion velocity
+// states, which sum to the rotor speed, if available in all linearizations.
+// Otherwise, it is estimated from the rotor speed by finite differences in
+// simulation time, which is zero if all linearizations are at the same time.
+func rotorAccelerations(linData []*LinData) []float64 {
+
+	// Accelerations from state derivative operating points
+	acc, ok := operPointAccelerations(linData)
+	if ok {
+		return acc
+	}
+
+	// Order linearizations by simulation time
+	order := make([]int, len(linData))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return linData[order[i]].SimTime < linData[order[j]].SimTime
+	})
+
+	// Central differences in the interior and one-sided at the ends
+	for k, i := range order {
+		prev, next := order[k], order[k]
+		if k > 0 {
+			prev = order[k-1]
+		}
+		if k < len(order)-1 {
+			next = order[k+1]
+		}
+		dt := linData[next].SimTime - linData[prev].SimTime
+		acc[i] = 0
+		if dt > 0 {
+			acc[i] = (linData[next].RotorSpeed - linData[prev].RotorSpeed) / dt
+		}
+	}
+
+	return acc
+}
+
+// operPointAccelerations returns the rotor acceleration (rad/s^2) for each
+// linearization from the state derivative operating points of the ElastoDyn
+// generator azimuth and drivetrain torsion velocity states. The second return
+// value is false if the generator azimuth state isn't in all linearizations.
+func operPointAccelerations(linData []*LinData) ([]float64, bool) {
+
+	acc := make([]float64, len(linData))
+	for i, ld := range linData {
+		found := false
+		if len(ld.Xd) == len(ld.X) {
+			for j, op := range ld.X {
+				cd := ParseDesc(op.Desc)
+				if cd.Module != "ED" || cd.Deriv != 1 {
+					continue
+				}
+				switch cd.DOF {
+				case "DOF_GeAz":
+					found = true
+					acc[i] += ld.Xd[j].OperPoint
+				case "DOF_DrTr":
+					acc[i] += ld.Xd[j].OperPoint
+				}
+			}
+		}
+		if !found {
+			return make([]float64, len(linData)), false
+		}
+	}
+	return acc, true
+}
+
+// isAngle returns true if the operating point description has units of radians.
+func isAngle(desc string) bool {
+	return strings.HasSuffix(desc, ", rad")
+}
+
+func tripletsToPermutations(ndof, numBlades int, triplets [][]int) ([]int, error) {
 
 	tripletDOFs := map[int]struct{}{}
-	tripletsPerms := make([]int, 0, len(triplets)*3)
+	tripletsPerms := make([]int, 0, len(triplets)*numBlades)
 	for _, triplet := range triplets {
-		if len(triplet) != 3 {
-			return nil, fmt.Errorf("number of values in triplet must be 3: %v", triplet)
+		if len(triplet) != numBlades {
+			return nil, fmt.Errorf("number of values in triplet must be %d: %v", numBlades, triplet)
 		}
 		for _, rc := range triplet {
 			tripletDOFs[rc] = struct{}{}
@@ -423,51 +735,176 @@ func tripletsToPermutations(ndof int, triplets [][]int) ([]int, error) {
 	return permutations, nil
 }
 
-// Regular expressions to find blades in operating point descriptions
-var bladeRe = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)blade\s+\d`),
-	regexp.MustCompile(`(?i)blade root \d`),
-	regexp.MustCompile(`(?i)PitchBearing\d`),
-	regexp.MustCompile(`(?i)BD_\d`),
-	regexp.MustCompile(`(?i)BD\d`),
+// mbcOperPoints returns the operating point data reordered by the
+// permutation. Entries after the first numFixed are blade triplets which are
+// converted to the nonrotating frame, so the blade number in the description
+// is replaced by the name of the MBC coordinate (collective, cosine, etc.).
+func mbcOperPoints(ops []OperPointData, perm []int, numFixed, numBlades int) []OperPointData {
+	coordNames := bladeCoordNames(numBlades)
+	mbcOps := make([]OperPointData, len(perm))
+	for i, p := range perm {
+		mbcOps[i] = ops[p]
+		if i < numFixed {
+			continue
+		}
+		mbcOps[i].IsRotating = false
+		mbcOps[i].Desc = replaceBladeNumber(ops[p].Desc, coordNames[(i-numFixed)%numBlades])
+	}
+	return mbcOps
 }
 
-func findBladeTriplets(opd []OperPointData) [][]int {
+// bladeCoordNames returns the names of the MBC coordinates in the order of
+// the columns of the blade transformation matrix.
+func bladeCoordNames(numBlades int) []string {
+	names := []string{"collective"}
+	for k := 1; k <= (numBlades-1)/2; k++ {
+		if k == 1 {
+			names = append(names, "cosine", "sine")
+		} else {
+			names = append(names, fmt.Sprintf("cosine %d", k), fmt.Sprintf("sine %d", k))
+		}
+	}
+	if numBlades%2 == 0 {
+		names = append(names, "differential")
+	}
+	return names
+}
 
-	// Create local copy of operating point data containing only rotating frame points
-	opl := []OperPointData{}
-	for _, op := range opd {
-		if op.IsRotating {
-			opl = append(opl, op)
+// replaceBladeNumber replaces the blade number found in the description by
+// the blade regular expressions with the given name.
+func replaceBladeNumber(desc, name string) string {
+	for _, re := range bladeRe {
+		loc := re.FindStringSubmatchIndex(desc)
+		if loc == nil {
+			continue
 		}
+		prefix := desc[:loc[2]]
+		if !strings.HasSuffix(prefix, " ") && !strings.HasSuffix(prefix, "_") {
+			prefix += " "
+		}
+		return prefix + name + desc[loc[3]:]
 	}
+	return desc
+}
 
-	// Sort operating points by description
-	sort.SliceStable(opl, func(i, j int) bool {
-		return opl[i].Desc < opl[j].Desc
-	})
+// numBladesFromTriplets returns the number of blades as the size of the first
+// blade triplet found, or zero if no triplets were found.
+func numBladesFromTriplets(tripletSets ...[][]int) int {
+	for _, triplets := range tripletSets {
+		if len(triplets) > 0 {
+			return len(triplets[0])
+		}
+	}
+	return 0
+}
 
-	// Find triplets based on descriptions
-	prefix := ""
-	triplets := [][]int{}
-	for _, op := range opl {
-		if prefix != "" && strings.HasPrefix(op.Desc, prefix) {
-			triplets[0] = append(triplets[0], op.RC)
-			continue
+// bladeTransforms returns the matrix t_tilde (eq. 9) which transforms the
+// nonrotating blade coordinates into the individual blade coordinates at the
+// given azimuth (rad), its inverse, and its first and second derivatives with
+// respect to azimuth, t_tilde_2 and t_tilde_3 (eq. 16). Columns of t_tilde
+// are the collective, cosine and sine coordinates for each harmonic up to
+// (numBlades-1)/2, followed by the differential coordinate for an even number
+// of blades. The differential coordinate is independent of azimuth, so for a
+// two-bladed rotor the transformation is the constant collective/differential
+// transform since a true Coleman transform does not exist. If numBlades is
+// less than one, such as for a model without blade triplets, there are no
+// blade coordinates and empty matrices are returned.
+func bladeTransforms(numBlades int, azimuth float64) (tt, ttv, tt2, tt3 *mat.Dense) {
+
+	if numBlades < 1 {
+		return &mat.Dense{}, &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+	}
+
+	n := float64(numBlades)
+	tt = mat.NewDense(numBlades, numBlades, nil)
+	ttv = mat.NewDense(numBlades, numBlades, nil)
+	tt2 = mat.NewDense(numBlades, numBlades, nil)
+	tt3 = mat.NewDense(numBlades, numBlades, nil)
+
+	for i := 0; i < numBlades; i++ {
+
+		// Blade azimuth
+		az := azimuth + 2*math.Pi*float64(i)/n
+
+		// Collective
+		tt.Set(i, 0, 1)
+		ttv.Set(0, i, 1/n)
+
+		// Cosine and sine for each harmonic
+		for k := 1; k <= (numBlades-1)/2; k++ {
+			fk := float64(k)
+			s, c := math.Sincos(fk * az)
+			tt.Set(i, 2*k-1, c)
+			tt.Set(i, 2*k, s)
+			ttv.Set(2*k-1, i, 2*c/n)
+			ttv.Set(2*k, i, 2*s/n)
+			tt2.Set(i, 2*k-1, -fk*s)
+			tt2.Set(i, 2*k, fk*c)
+			tt3.Set(i, 2*k-1, -fk*fk*c)
+			tt3.Set(i, 2*k, -fk*fk*s)
 		}
-		desc := op.Desc
-		if i := strings.Index(desc, "("); i != -1 {
-			if j := strings.LastIndex(desc, ")"); j != -1 {
-				desc = desc[:i] + desc[j+1:]
+
+		// Differential
+		if numBlades%2 == 0 {
+			d := 1.0
+			if i%2 == 1 {
+				d = -1
 			}
+			tt.Set(i, numBlades-1, d)
+			ttv.Set(numBlades-1, i, d/n)
 		}
-		for _, re := range bladeRe {
-			if loc := re.FindStringIndex(desc); loc != nil {
-				prefix = desc[:loc[0]]
-				triplets = append([][]int{{op.RC}}, triplets...)
-				break
-			}
+	}
+
+	return tt, ttv, tt2, tt3
+}
+
+// Regular expressions to find blades in operating point descriptions, the
+// submatch is the blade number
+var bladeRe = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)blade\s+(\d+)`),
+	regexp.MustCompile(`(?i)blade root (\d+)`),
+	regexp.MustCompile(`(?i)PitchBearing(\d+)`),
+	regexp.MustCompile(`(?i)BD_(\d+)`),
+	regexp.MustCompile(`(?i)BD(\d+)`),
+}
+
+func findBladeTriplets(opd []OperPointData) [][]int {
+
+	// Group rotating frame points which differ only by blade number
+	type tripletKey struct {
+		module, quantity, unit string
+		node, deriv            int
+	}
+	type bladePoint struct{ blade, rc int }
+	groups := map[tripletKey][]bladePoint{}
+	keys := []tripletKey{}
+	for _, op := range opd {
+		if !op.IsRotating {
+			continue
+		}
+		cd := ParseDesc(op.Desc)
+		if cd.Blade == 0 {
+			continue
+		}
+		key := tripletKey{cd.Module, cd.Quantity, cd.Unit, cd.Node, cd.Deriv}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
 		}
+		groups[key] = append(groups[key], bladePoint{cd.Blade, op.RC})
+	}
+
+	// Create triplets with points ordered by blade number
+	triplets := make([][]int, 0, len(keys))
+	for _, key := range keys {
+		points := groups[key]
+		sort.SliceStable(points, func(i, j int) bool {
+			return points[i].blade < points[j].blade
+		})
+		triplet := make([]int, len(points))
+		for i, p := range points {
+			triplet[i] = p.rc
+		}
+		triplets = append(triplets, triplet)
 	}
 
 	// Sort triplets by first number
@@ -478,6 +915,27 @@ func findBladeTriplets(opd []OperPointData) [][]int {
 	return triplets
 }
 
+// offsetTriplets returns a copy of triplets with offset added to each
+// row/column number.
+func offsetTriplets(triplets [][]int, offset int) [][]int {
+	out := make([][]int, len(triplets))
+	for i, triplet := range triplets {
+		out[i] = make([]int, len(triplet))
+		for j, rc := range triplet {
+			out[i][j] = rc + offset
+		}
+	}
+	return out
+}
+
+func identityPermutation(n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	return perm
+}
+
 func NewOnesVec(n int) []float64 {
 	s := make([]float64, n)
 	for i := range s {
@@ -497,41 +955,6 @@ func eye(n int) *mat.Dense {
 	return mat.NewDense(n, n, d)
 }
 
-func blockDiag(base *mat.Dense, other ...*mat.Dense) *mat.Dense {
-
-	mats := append([]*mat.Dense{base}, other...)
-
-	size := 0
-	for _, m := range mats {
-		_, c := m.Dims()
-		size += c
-	}
-
-	if size == 0 {
-		return &mat.Dense{}
-	}
-
-	M := mat.NewDense(size, size, nil)
-	c := 0
-	for _, m := range mats {
-		_, cm := m.Dims()
-		if cm > 0 {
-			M.Slice(c, c+cm, c, c+cm).(*mat.Dense).Copy(m)
-			c += cm
-		}
-	}
-
-	return M
-}
-
-func Repeat[T any](item T, n int) []T {
-	s := make([]T, n)
-	for i := range s {
-		s[i] = item
-	}
-	return s
-}
-
 func toCSV(m mat.Matrix, path string) error {
 	buf := &bytes.Buffer{}
 	r, c := m.Dims()
@@ -0,0 +1,486 @@
+package anl_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestCollectMatrixData(t *testing.T) {
+
+	testCases := []struct {
+		numBlades     int
+		specifyBlades bool
+	}{
+		{numBlades: 3, specifyBlades: true},
+		{numBlades: 3, specifyBlades: false},
+		{numBlades: 2, specifyBlades: true},
+		{numBlades: 4, specifyBlades: false},
+		{numBlades: 5, specifyBlades: false},
+		{numBlades: 1, specifyBlades: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("%d-blades", tc.numBlades), func(t *testing.T) {
+
+			azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+			ts := newTestSystem(tc.numBlades, 1.2, azimuths)
+
+			numBlades := 0
+			if tc.specifyBlades {
+				numBlades = tc.numBlades
+			}
+
+			md, err := anl.CollectMatrixData(ts.LinData, numBlades, 4)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if md.NumBlades != tc.numBlades {
+				t.Fatalf("NumBlades = %d, expected %d", md.NumBlades, tc.numBlades)
+			}
+			if len(md.Rotation.TripletsStates2) != 1 {
+				t.Fatalf("TripletsStates2 = %v, expected one triplet", md.Rotation.TripletsStates2)
+			}
+			if len(md.Rotation.TripletsInputs) != 1 {
+				t.Fatalf("TripletsInputs = %v, expected one triplet", md.Rotation.TripletsInputs)
+			}
+			if len(md.Rotation.TripletsOutputs) != 1 {
+				t.Fatalf("TripletsOutputs = %v, expected one triplet", md.Rotation.TripletsOutputs)
+			}
+
+			for i := range azimuths {
+				assertMatEqual(t, "A", md.A[i], ts.A, 1e-10)
+				assertMatEqual(t, "B", md.B[i], ts.B, 1e-10)
+				assertMatEqual(t, "C", md.C[i], ts.C, 1e-10)
+				assertMatEqual(t, "D", md.D[i], ts.D, 1e-10)
+				assertMatEqual(t, "OpX", md.OpX[i], ts.OpX, 1e-10)
+				assertMatEqual(t, "OpXd", md.OpXd[i], ts.OpXd, 1e-10)
+			}
+			assertMatEqual(t, "AvgA", md.AvgA, ts.A, 1e-10)
+			assertMatEqual(t, "AvgB", md.AvgB, ts.B, 1e-10)
+			assertMatEqual(t, "AvgC", md.AvgC, ts.C, 1e-10)
+			assertMatEqual(t, "AvgD", md.AvgD, ts.D, 1e-10)
+			assertMatEqual(t, "AvgOpX", md.AvgOpX, ts.OpX, 1e-10)
+			assertMatEqual(t, "AvgOpXd", md.AvgOpXd, ts.OpXd, 1e-10)
+		})
+	}
+}
+
+func TestCollectMatrixDataUnwrap(t *testing.T) {
+
+	// Yaw angle oscillating about pi, wrapped to [-pi, pi]
+	yaw := []float64{3.13, -3.13, 3.12, -3.14}
+
+	linData := make([]*anl.LinData, len(yaw))
+	for i, v := range yaw {
+		linData[i] = &anl.LinData{
+			Azimuth: float64(i) * math.Pi / 2,
+			NumX:    2,
+			NumX2:   2,
+			X: []anl.OperPointData{
+				{RC: 1, OperPoint: v, DerivOrder: 2, Desc: "ED Nacelle yaw DOF (internal DOF index = DOF_Yaw), rad"},
+				{RC: 2, DerivOrder: 2, Desc: "ED First time derivative of Nacelle yaw DOF (internal DOF index = DOF_Yaw), rad/s"},
+			},
+			A: mat.NewDense(2, 2, []float64{0, 1, -1, 0}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := (3.13 + (2*math.Pi - 3.13) + 3.12 + (2*math.Pi - 3.14)) / 4
+	if act := md.AvgOpX.AtVec(0); math.Abs(act-exp) > 1e-12 {
+		t.Fatalf("AvgOpX[0] = %v, expected %v", act, exp)
+	}
+}
+
+func TestCollectMatrixDataModeTypes(t *testing.T) {
+
+	// First order system with oscillatory, overdamped, rigid-body, and
+	// unstable eigenvalues
+	A := mat.NewDense(6, 6, []float64{
+		-0.1, 2, 0, 0, 0, 0,
+		-2, -0.1, 0, 0, 0, 0,
+		0, 0, -3, 0, 0, 0,
+		0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0.5, 1,
+		0, 0, 0, 0, -1, 0.5,
+	})
+	ld := &anl.LinData{NumX: 6, A: A}
+	for i := 0; i < 6; i++ {
+		ld.X = append(ld.X, anl.OperPointData{RC: i + 1, DerivOrder: 1,
+			Desc: fmt.Sprintf("AD state %d, -", i+1)})
+	}
+	ld.Xd = ld.X
+
+	md, err := anl.CollectMatrixData([]*anl.LinData{ld}, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expTypes := []string{anl.ModeRigidBody, anl.ModeUnstable, anl.ModeOscillatory, anl.ModeOverdamped}
+	if len(md.Modes) != len(expTypes) {
+		t.Fatalf("len(Modes) = %d, expected %d", len(md.Modes), len(expTypes))
+	}
+	for i, mode := range md.Modes {
+		if mode.Type != expTypes[i] {
+			t.Errorf("Modes[%d].Type = %q, expected %q", i, mode.Type, expTypes[i])
+		}
+	}
+}
+
+func TestCollectMatrixDataModeStates(t *testing.T) {
+
+	ts := newTestSystem(3, 1.2, []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2})
+
+	// Add a first order state to each linearization
+	for _, ld := range ts.LinData {
+		A := mat.NewDense(ld.NumX+1, ld.NumX+1, nil)
+		A.Slice(0, ld.NumX, 0, ld.NumX).(*mat.Dense).Copy(ld.A)
+		A.Set(ld.NumX, ld.NumX, -2)
+		A.Set(ld.NumX, 0, 0.1)
+		ld.A = A
+		B := mat.NewDense(ld.NumX+1, ld.NumU, nil)
+		B.Slice(0, ld.NumX, 0, ld.NumU).(*mat.Dense).Copy(ld.B)
+		ld.B = B
+		C := mat.NewDense(ld.NumY, ld.NumX+1, nil)
+		C.Slice(0, ld.NumY, 0, ld.NumX).(*mat.Dense).Copy(ld.C)
+		ld.C = C
+		op := anl.OperPointData{RC: ld.NumX + 1, DerivOrder: 1,
+			Desc: "AD Dynamic inflow state, m/s"}
+		ld.X = append(ld.X, op)
+		ld.Xd = append(ld.Xd, op)
+		ld.NumX++
+	}
+
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expDesc := []string{
+		"ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m",
+		"ED 1st flapwise bending-mode DOF of blade collective (internal DOF index = DOF_BF(1,1)), m",
+		"ED 1st flapwise bending-mode DOF of blade cosine (internal DOF index = DOF_BF(2,1)), m",
+		"ED 1st flapwise bending-mode DOF of blade sine (internal DOF index = DOF_BF(3,1)), m",
+		"AD Dynamic inflow state, m/s",
+	}
+	expDerivOrder := []int{2, 2, 2, 2, 1}
+	if len(md.ModeStates) != len(expDesc) {
+		t.Fatalf("len(ModeStates) = %d, expected %d", len(md.ModeStates), len(expDesc))
+	}
+	for i, op := range md.ModeStates {
+		if op.Desc != expDesc[i] || op.DerivOrder != expDerivOrder[i] || op.IsRotating {
+			t.Errorf("ModeStates[%d] = %+v, expected Desc %q, DerivOrder %d", i, op, expDesc[i], expDerivOrder[i])
+		}
+	}
+	for _, mode := range md.Modes {
+		if len(mode.EigenVector) != len(md.ModeStates) {
+			t.Fatalf("len(EigenVector) = %d, expected %d", len(mode.EigenVector), len(md.ModeStates))
+		}
+	}
+}
+
+func TestCollectMatrixDataOmegaDot(t *testing.T) {
+
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	numBlades, nq := 3, 4
+
+	// Rename the tower DOF as the generator DOF so the rotor acceleration is
+	// read from its velocity state derivative operating point
+	collect := func(omegaDot float64) *anl.MatData {
+		ts := newTestSystem(numBlades, 1.2, azimuths)
+		for _, ld := range ts.LinData {
+			ld.X[nq-1].Desc = "ED Variable speed generator DOF (internal DOF index = DOF_GeAz), rad"
+			ld.X[2*nq-1].Desc = "ED First time derivative of Variable speed generator DOF (internal DOF index = DOF_GeAz), rad/s"
+			ld.Xd[2*nq-1].OperPoint = omegaDot
+		}
+		md, err := anl.CollectMatrixData(ts.LinData, numBlades, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return md
+	}
+	md0, md1 := collect(0), collect(0.3)
+
+	for i := 0; i < md1.NumStep; i++ {
+		if v := md1.OmegaDot.AtVec(i); v != 0.3 {
+			t.Errorf("OmegaDot[%d] = %v, expected 0.3", i, v)
+		}
+	}
+
+	// Acceleration adds -omegaDot*T1^-1*T2 to the blade velocity equations,
+	// which couples the cosine and sine displacements
+	diff := &mat.Dense{}
+	diff.Sub(md1.AvgA, md0.AvgA)
+	expected := mat.NewDense(2*nq, 2*nq, nil)
+	expected.Set(nq+2, 3, -0.3)
+	expected.Set(nq+3, 2, 0.3)
+	if !mat.EqualApprox(diff, expected, 1e-12) {
+		t.Errorf("AvgA difference =\n%v\nexpected\n%v", mat.Formatted(diff), mat.Formatted(expected))
+	}
+}
+
+func TestCollectMatrixDataOmegaDotFiniteDifference(t *testing.T) {
+
+	// Rotor speed increasing linearly in simulation time, without generator
+	// DOF descriptions
+	linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+	for i, ld := range linData {
+		ld.SimTime = 10 + 0.5*float64(i)
+		ld.RotorSpeed = 1 + 0.1*float64(i)
+		ld.X = []anl.OperPointData{
+			{RC: 1, DerivOrder: 2, Desc: "ED Rotor DOF, rad"},
+			{RC: 2, DerivOrder: 2, Desc: "ED First time derivative of Rotor DOF, rad/s"},
+		}
+		ld.Xd = ld.X
+	}
+	md, err := anl.CollectMatrixData(linData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < md.NumStep; i++ {
+		if v := md.OmegaDot.AtVec(i); math.Abs(v-0.2) > 1e-12 {
+			t.Errorf("OmegaDot[%d] = %v, expected 0.2", i, v)
+		}
+	}
+}
+
+func TestCollectMatrixDataFirstOrderStates(t *testing.T) {
+
+	// Fixed frame first order model in MBC ordering (generator state, then
+	// blade collective, cosine, sine) with blade inputs and outputs
+	numBlades, n := 3, 4
+	omega := 1.2
+	A := mat.NewDense(n, n, nil)
+	B := mat.NewDense(n, numBlades, nil)
+	C := mat.NewDense(numBlades, n, nil)
+	D := mat.NewDense(numBlades, numBlades, nil)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			A.Set(i, j, 0.1*float64((i+2*j)%3))
+		}
+		A.Set(i, i, -1-0.5*float64(i))
+		for j := 0; j < numBlades; j++ {
+			B.Set(i, j, 0.1*float64(i+1)-0.05*float64(j))
+			C.Set(j, i, 1.0+0.1*float64(i*j))
+		}
+	}
+	for i := 0; i < numBlades; i++ {
+		for j := 0; j < numBlades; j++ {
+			D.Set(i, j, 0.02*float64(i-j))
+		}
+	}
+	opX := mat.NewVecDense(n, []float64{0.1, 0.2, 0.3, 0.4})
+	opXd := mat.NewVecDense(n, nil)
+	opXd.MulVec(A, opX)
+
+	// Transform into the rotating frame at many azimuths, with blade states
+	// before the generator state in file ordering
+	perm := []int{1, 2, 3, 0}
+	P := &mat.Dense{}
+	P.Permutation(n, perm)
+	var linData []*anl.LinData
+	for k := 0; k < 36; k++ {
+		az := 2 * math.Pi * float64(k) / 36
+		tt, tt2, _ := testBladeTransforms(numBlades, az)
+		ttv := &mat.Dense{}
+		ttv.Inverse(tt)
+		T1q := blkDiag(eye(1), tt)
+		T2q := blkDiag(mat.NewDense(1, 1, nil), tt2)
+		T2q.Scale(omega, T2q)
+		T1qv := &mat.Dense{}
+		T1qv.Inverse(T1q)
+
+		// x_rot = T1q*x_nr, xd_rot = omega*T2q*x_nr + T1q*xd_nr
+		AR, BR, CR, DR := &mat.Dense{}, &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+		AR.Mul(T1q, A)
+		AR.Add(AR, T2q)
+		AR.Mul(AR, T1qv)
+		AR.Mul(P, AR)
+		AR.Mul(AR, P.T())
+		BR.Mul(T1q, B)
+		BR.Mul(BR, ttv)
+		BR.Mul(P, BR)
+		CR.Mul(tt, C)
+		CR.Mul(CR, T1qv)
+		CR.Mul(CR, P.T())
+		DR.Mul(tt, D)
+		DR.Mul(DR, ttv)
+		opx, opxd, tmp := mat.NewVecDense(n, nil), mat.NewVecDense(n, nil), mat.NewVecDense(n, nil)
+		opx.MulVec(T1q, opX)
+		opxd.MulVec(T1q, opXd)
+		tmp.MulVec(T2q, opX)
+		opxd.AddVec(opxd, tmp)
+		opx.MulVec(P, opx)
+		opxd.MulVec(P, opxd)
+
+		ld := &anl.LinData{RotorSpeed: omega, Azimuth: az, WindSpeed: 10,
+			NumX: n, NumU: numBlades, NumY: numBlades, A: AR, B: BR, C: CR, D: DR}
+		for i := 1; i <= numBlades; i++ {
+			ld.X = append(ld.X, anl.OperPointData{RC: i, IsRotating: true, DerivOrder: 1,
+				Desc: fmt.Sprintf("AD Blade %d, node 1, dynamic stall state 1, -", i)})
+			ld.U = append(ld.U, anl.OperPointData{RC: i, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d pitch command, rad", i)})
+			ld.Y = append(ld.Y, anl.OperPointData{RC: i, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d root out-of-plane moment, kN-m", i)})
+		}
+		ld.X = append(ld.X, anl.OperPointData{RC: n, DerivOrder: 1,
+			Desc: "SrvD Generator first order state, -"})
+		ld.Xd = make([]anl.OperPointData, n)
+		for i := range ld.X {
+			ld.X[i].OperPoint = opx.AtVec(i)
+			ld.Xd[i] = ld.X[i]
+			ld.Xd[i].OperPoint = opxd.AtVec(i)
+		}
+		linData = append(linData, ld)
+	}
+
+	md, err := anl.CollectMatrixData(linData, numBlades, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Rotation.TripletsStates1) != 1 {
+		t.Fatalf("TripletsStates1 = %v, expected one triplet", md.Rotation.TripletsStates1)
+	}
+
+	// Every azimuth step should recover the fixed frame model
+	for i := 0; i < md.NumStep; i++ {
+		assertMatEqual(t, fmt.Sprintf("A[%d]", i), md.A[i], A, 1e-10)
+		assertMatEqual(t, fmt.Sprintf("B[%d]", i), md.B[i], B, 1e-10)
+		assertMatEqual(t, fmt.Sprintf("C[%d]", i), md.C[i], C, 1e-10)
+		assertMatEqual(t, fmt.Sprintf("D[%d]", i), md.D[i], D, 1e-10)
+		assertMatEqual(t, fmt.Sprintf("OpX[%d]", i), md.OpX[i], opX, 1e-10)
+		assertMatEqual(t, fmt.Sprintf("OpXd[%d]", i), md.OpXd[i], opXd, 1e-10)
+	}
+	assertMatEqual(t, "AvgA", md.AvgA, A, 1e-10)
+}
+
+func TestCollectMatrixDataNoBlades(t *testing.T) {
+
+	// Drivetrain model without blade inputs, so the number of blades can't be
+	// inferred from the triplets
+	linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+	for _, ld := range linData {
+		ld.NumU = 1
+		ld.U = []anl.OperPointData{{RC: 1, Desc: "ED Generator torque, Nm"}}
+		ld.B = mat.NewDense(2, 1, []float64{0, -0.01})
+		ld.D = mat.NewDense(1, 1, nil)
+	}
+	md, err := anl.CollectMatrixData(linData, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.NumBlades != 0 {
+		t.Errorf("NumBlades = %d, expected 0", md.NumBlades)
+	}
+	assertMatEqual(t, "AvgA", md.AvgA, linData[0].A, 1e-12)
+	assertMatEqual(t, "AvgB", md.AvgB, linData[0].B, 1e-12)
+}
+
+func TestCollectMatrixDataInconsistentDims(t *testing.T) {
+
+	// Dimensions are checked before transforming, so inconsistent files are
+	// returned as an error instead of panicking in a worker goroutine
+	for _, tc := range []struct {
+		name   string
+		modify func(ld *anl.LinData)
+		errMsg string
+	}{
+		{"matrix", func(ld *anl.LinData) {
+			ld.B = mat.NewDense(2, 2, nil)
+		}, "matrix B is 2 x 2, expected 2 x 4"},
+		{"missing matrix", func(ld *anl.LinData) {
+			ld.C = nil
+		}, "matrix C is missing"},
+		{"operating points", func(ld *anl.LinData) {
+			ld.X = append(ld.X, ld.X[1])
+		}, "3 state operating points, expected 2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+			for i, ld := range linData {
+				ld.FilePath = fmt.Sprintf("turb.%d.lin", i+1)
+			}
+			tc.modify(linData[2])
+			_, err := anl.CollectMatrixData(linData, 3, 1)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), "linearization 3 at azimuth 180.00 deg from 'turb.3.lin'") {
+				t.Errorf("error '%v' doesn't identify the linearization", err)
+			}
+			if !strings.Contains(err.Error(), tc.errMsg) {
+				t.Errorf("error '%v' doesn't contain '%s'", err, tc.errMsg)
+			}
+		})
+	}
+}
+
+func TestCollectMatrixDataModuleStateOrdering(t *testing.T) {
+
+	// Rewrite the test system with the blade flap DOFs in BeamDyn and the
+	// states in OpenFAST ordering, where each module's displacements are
+	// followed by its velocities: ED q, ED qd, BD_1 q, BD_1 qd, BD_2 q, ...
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+	perm := []int{3, 7, 0, 4, 1, 5, 2, 6}
+	P := &mat.Dense{}
+	P.Permutation(len(perm), perm)
+	for _, ld := range ts.LinData {
+		x := make([]anl.OperPointData, len(perm))
+		xd := make([]anl.OperPointData, len(perm))
+		for i, p := range perm {
+			x[i], xd[i] = ld.X[p], ld.Xd[p]
+			x[i].RC, xd[i].RC = i+1, i+1
+			if x[i].IsRotating {
+				b := p%4 + 1
+				desc := fmt.Sprintf("BD_%d 1st flapwise bending-mode DOF, m", b)
+				if p >= 4 {
+					desc = fmt.Sprintf("BD_%d First time derivative of 1st flapwise bending-mode DOF, m/s", b)
+				}
+				x[i].Desc, xd[i].Desc = desc, desc
+			}
+		}
+		ld.X, ld.Xd = x, xd
+		ld.A.Mul(P, ld.A)
+		ld.A.Mul(ld.A, P.T())
+		ld.B.Mul(P, ld.B)
+		ld.C.Mul(ld.C, P.T())
+	}
+
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(md.Rotation.TripletsStates2) != 1 {
+		t.Fatalf("TripletsStates2 = %v, expected one triplet", md.Rotation.TripletsStates2)
+	}
+	expDesc := []string{
+		"ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m",
+		"BD_collective 1st flapwise bending-mode DOF, m",
+		"BD_cosine 1st flapwise bending-mode DOF, m",
+		"BD_sine 1st flapwise bending-mode DOF, m",
+		"ED First time derivative of 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m/s",
+	}
+	for i, exp := range expDesc {
+		if md.DescStates[i].Desc != exp {
+			t.Errorf("DescStates[%d] = %q, expected %q", i, md.DescStates[i].Desc, exp)
+		}
+	}
+	for i := range azimuths {
+		assertMatEqual(t, "A", md.A[i], ts.A, 1e-10)
+		assertMatEqual(t, "B", md.B[i], ts.B, 1e-10)
+		assertMatEqual(t, "C", md.C[i], ts.C, 1e-10)
+		assertMatEqual(t, "OpX", md.OpX[i], ts.OpX, 1e-10)
+		assertMatEqual(t, "OpXd", md.OpXd[i], ts.OpXd, 1e-10)
+	}
+}
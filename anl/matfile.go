@@ -0,0 +1,347 @@
+package anl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"time"
+	"unicode/utf16"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MATLAB Level 5 MAT-file data types and array classes
+const (
+	miINT8   = 1
+	miUINT16 = 4
+	miINT32  = 5
+	miUINT32 = 6
+	miDOUBLE = 9
+	miMATRIX = 14
+
+	mxCELL_CLASS   = 1
+	mxCHAR_CLASS   = 4
+	mxDOUBLE_CLASS = 6
+)
+
+// Maximum number of bytes in a Level 5 MAT-file data element and maximum
+// array dimension, which are stored as 32 bit integers
+const (
+	matMaxElementSize = math.MaxUint32
+	matMaxDim         = math.MaxInt32
+)
+
+// matFile builds a MATLAB Level 5 MAT-file containing double arrays and cell
+// arrays of strings as top level variables. The first error adding a
+// variable, such as an array too large for the format, is returned by Save.
+type matFile struct {
+	buf bytes.Buffer
+	err error
+}
+
+func newMATFile() *matFile {
+	mf := &matFile{}
+	header := fmt.Sprintf("MATLAB 5.0 MAT-file, Platform: acdc, Created on: %s",
+		time.Now().Format("Mon Jan 2 15:04:05 2006"))
+	text := make([]byte, 116)
+	copy(text, bytes.Repeat([]byte(" "), 116))
+	copy(text, header)
+	mf.buf.Write(text)
+	mf.buf.Write(make([]byte, 8))                              // Subsystem data offset
+	binary.Write(&mf.buf, binary.LittleEndian, uint16(0x0100)) // Version
+	mf.buf.WriteString("IM")                                   // Little endian indicator
+	return mf
+}
+
+// Save writes the MAT-file to the path.
+func (mf *matFile) Save(path string) error {
+	if mf.err != nil {
+		return mf.err
+	}
+	return os.WriteFile(path, mf.buf.Bytes(), 0777)
+}
+
+// fits returns true if a double array with the given dimensions can be
+// stored in a Level 5 MAT-file. Otherwise the error is recorded for Save, so
+// the data for large arrays isn't assembled.
+func (mf *matFile) fits(name string, dims []int) bool {
+	if mf.err != nil {
+		return false
+	}
+	size := uint64(8)
+	for _, d := range dims {
+		if d > matMaxDim || (d > 0 && size > matMaxElementSize/uint64(d)) {
+			mf.err = fmt.Errorf("variable %s with dimensions %v exceeds the %d byte MAT-file element size limit",
+				name, dims, uint64(matMaxElementSize))
+			return false
+		}
+		size *= uint64(d)
+	}
+	return true
+}
+
+// Scalar adds a scalar variable.
+func (mf *matFile) Scalar(name string, v float64) {
+	mf.Double(name, []int{1, 1}, []float64{v})
+}
+
+// Vector adds a column vector variable.
+func (mf *matFile) Vector(name string, v []float64) {
+	mf.Double(name, []int{len(v), 1}, v)
+}
+
+// Matrix adds a matrix variable, an empty matrix if m is nil.
+func (mf *matFile) Matrix(name string, m *mat.Dense) {
+	if m == nil {
+		mf.Double(name, []int{0, 0}, nil)
+		return
+	}
+	r, c := m.Dims()
+	if !mf.fits(name, []int{r, c}) {
+		return
+	}
+	data := make([]float64, 0, r*c)
+	for j := 0; j < c; j++ {
+		for i := 0; i < r; i++ {
+			data = append(data, m.At(i, j))
+		}
+	}
+	mf.Double(name, []int{r, c}, data)
+}
+
+// Matrices adds a three dimensional array variable with the matrices stacked
+// along the third dimension, an empty matrix if there are no matrices.
+func (mf *matFile) Matrices(name string, ms []*mat.Dense) {
+	if len(ms) == 0 || ms[0] == nil {
+		mf.Double(name, []int{0, 0}, nil)
+		return
+	}
+	r, c := ms[0].Dims()
+	if !mf.fits(name, []int{r, c, len(ms)}) {
+		return
+	}
+	data := make([]float64, 0, r*c*len(ms))
+	for _, m := range ms {
+		for j := 0; j < c; j++ {
+			for i := 0; i < r; i++ {
+				data = append(data, m.At(i, j))
+			}
+		}
+	}
+	mf.Double(name, []int{r, c, len(ms)}, data)
+}
+
+// Double adds a double array variable with the given dimensions and data in
+// column major order.
+func (mf *matFile) Double(name string, dims []int, data []float64) {
+	if !mf.fits(name, dims) {
+		return
+	}
+	body := &bytes.Buffer{}
+	writeArrayHeader(body, mxDOUBLE_CLASS, dims, name)
+	bs := make([]byte, 8*len(data))
+	for i, v := range data {
+		binary.LittleEndian.PutUint64(bs[8*i:], math.Float64bits(v))
+	}
+	writeElement(body, miDOUBLE, bs)
+	mf.writeVariable(name, body.Bytes())
+}
+
+// Strings adds a cell array variable with one string per row.
+func (mf *matFile) Strings(name string, ss []string) {
+	if mf.err != nil {
+		return
+	}
+	body := &bytes.Buffer{}
+	writeArrayHeader(body, mxCELL_CLASS, []int{len(ss), 1}, name)
+	for _, s := range ss {
+		writeElement(body, miMATRIX, charArray(s))
+	}
+	mf.writeVariable(name, body.Bytes())
+}
+
+// writeVariable writes the body of a top level matrix element, recording an
+// error if it exceeds the element size limit. Subelements are smaller than
+// the body so they don't need to be checked.
+func (mf *matFile) writeVariable(name string, body []byte) {
+	if uint64(len(body)) > matMaxElementSize {
+		mf.err = fmt.Errorf("variable %s of %d bytes exceeds the %d byte MAT-file element size limit",
+			name, len(body), uint64(matMaxElementSize))
+		return
+	}
+	writeElement(&mf.buf, miMATRIX, body)
+}
+
+// charArray returns the body of an unnamed char array element.
+func charArray(s string) []byte {
+	chars := utf16.Encode([]rune(s))
+	body := &bytes.Buffer{}
+	writeArrayHeader(body, mxCHAR_CLASS, []int{1, len(chars)}, "")
+	bs := make([]byte, 2*len(chars))
+	for i, c := range chars {
+		binary.LittleEndian.PutUint16(bs[2*i:], c)
+	}
+	writeElement(body, miUINT16, bs)
+	return body.Bytes()
+}
+
+// writeArrayHeader writes the array flags, dimensions, and name subelements
+// of a matrix element.
+func writeArrayHeader(buf *bytes.Buffer, class int, dims []int, name string) {
+	flags := make([]byte, 8)
+	binary.LittleEndian.PutUint32(flags, uint32(class))
+	writeElement(buf, miUINT32, flags)
+	bs := make([]byte, 4*len(dims))
+	for i, d := range dims {
+		binary.LittleEndian.PutUint32(bs[4*i:], uint32(d))
+	}
+	writeElement(buf, miINT32, bs)
+	writeElement(buf, miINT8, []byte(name))
+}
+
+// writeElement writes a data element tag and data padded to 8 bytes.
+func writeElement(buf *bytes.Buffer, dataType int, data []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(dataType))
+	binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	buf.Write(data)
+	if pad := len(data) % 8; pad != 0 {
+		buf.Write(make([]byte, 8-pad))
+	}
+}
+
+// WriteMAT writes the linearization data to a MATLAB Level 5 MAT-file. The
+// file contains the header values as scalars, the state-space matrices, and
+// for the states (x), state derivatives (xdot), inputs (u), outputs (y), and
+// constraint states (z) the operating points, descriptions, rotating frame
+// flags, and derivative orders, e.g. x_op, x_desc, x_rotFrame, and
+// x_derivOrder. If the file included Jacobians, dUdu, dUdy, and dXdy are
+// also written.
+func (ld *LinData) WriteMAT(path string) error {
+	mf := newMATFile()
+	mf.Scalar("t", ld.SimTime)
+	mf.Scalar("RotSpeed", ld.RotorSpeed)
+	mf.Scalar("Azimuth", ld.Azimuth)
+	mf.Scalar("WindSpeed", ld.WindSpeed)
+	mf.Scalar("n_x", float64(ld.NumX))
+	mf.Scalar("n_x2", float64(ld.NumX2))
+	mf.Scalar("n_u", float64(ld.NumU))
+	mf.Scalar("n_y", float64(ld.NumY))
+	mf.Matrix("A", ld.A)
+	mf.Matrix("B", ld.B)
+	mf.Matrix("C", ld.C)
+	mf.Matrix("D", ld.D)
+	writeOperPointsMAT(mf, "x", ld.X)
+	writeOperPointsMAT(mf, "xdot", ld.Xd)
+	writeOperPointsMAT(mf, "u", ld.U)
+	writeOperPointsMAT(mf, "y", ld.Y)
+	writeOperPointsMAT(mf, "z", ld.Z)
+	if ld.HasJacobians {
+		mf.Matrix("dUdu", ld.DUdu)
+		mf.Matrix("dUdy", ld.DUdy)
+		mf.Matrix("dXdy", ld.DXdy)
+	}
+	return mf.Save(path)
+}
+
+// WriteMAT writes the matrix data to a MATLAB Level 5 MAT-file. The file
+// contains the MBC state-space matrices at each azimuth (A, B, C, D, stacked
+// along the third dimension), the azimuth averaged matrices (AvgA, etc.), the
+// rotating frame matrices from the linearization files in azimuth order
+// (RawA, etc.), the azimuth (deg), rotor speed (rad/s), and wind speed (m/s)
+// of each step, the operating points (OpX, OpXd, AvgOpX, AvgOpXd), and the
+// state, input, and output descriptions in MBC ordering (DescStates, etc.) and
+// linearization file ordering (RawDescStates, etc.). An error is returned if
+// a variable exceeds the 4 GiB element size limit of the format.
+func (md *MatData) WriteMAT(path string) error {
+	return md.writeMAT(path, true)
+}
+
+// writeMAT writes the matrix data to a MAT-file, omitting the matrices at
+// each azimuth (A, B, C, D, RawA, etc.) unless steps is true.
+func (md *MatData) writeMAT(path string, steps bool) error {
+	mf := newMATFile()
+	mf.Scalar("NumBlades", float64(md.NumBlades))
+	mf.Scalar("NumStates", float64(md.NumStates))
+	mf.Scalar("NumDOF2", float64(md.NumDOF2))
+	mf.Scalar("NumDOF1", float64(md.NumDOF1))
+	mf.Scalar("NumInputs", float64(md.NumInputs))
+	mf.Scalar("NumOutputs", float64(md.NumOutputs))
+	mf.Vector("Azimuth", vecToSlice(md.Azimuth))
+	mf.Vector("Omega", vecToSlice(md.Omega))
+	mf.Vector("OmegaDot", vecToSlice(md.OmegaDot))
+	mf.Vector("WindSpeed", vecToSlice(md.WindSpeed))
+	if steps {
+		mf.Matrices("A", md.A)
+		mf.Matrices("B", md.B)
+		mf.Matrices("C", md.C)
+		mf.Matrices("D", md.D)
+	}
+	mf.Matrix("AvgA", md.AvgA)
+	mf.Matrix("AvgB", md.AvgB)
+	mf.Matrix("AvgC", md.AvgC)
+	mf.Matrix("AvgD", md.AvgD)
+	mf.Matrix("OpX", vecsToDense(md.OpX))
+	mf.Matrix("OpXd", vecsToDense(md.OpXd))
+	mf.Vector("AvgOpX", vecToSlice(md.AvgOpX))
+	mf.Vector("AvgOpXd", vecToSlice(md.AvgOpXd))
+	mf.Strings("DescStates", descriptions(md.DescStates))
+	mf.Strings("DescInputs", descriptions(md.DescInputs))
+	mf.Strings("DescOutputs", descriptions(md.DescOutputs))
+
+	// Linearization data is sorted by azimuth like the MBC matrices
+	linData := md.LinData
+	raw := func(get func(*LinData) *mat.Dense) []*mat.Dense {
+		ms := make([]*mat.Dense, len(linData))
+		for i, ld := range linData {
+			ms[i] = get(ld)
+		}
+		return ms
+	}
+	if steps {
+		mf.Matrices("RawA", raw(func(ld *LinData) *mat.Dense { return ld.A }))
+		mf.Matrices("RawB", raw(func(ld *LinData) *mat.Dense { return ld.B }))
+		mf.Matrices("RawC", raw(func(ld *LinData) *mat.Dense { return ld.C }))
+		mf.Matrices("RawD", raw(func(ld *LinData) *mat.Dense { return ld.D }))
+	}
+	if len(linData) > 0 {
+		mf.Strings("RawDescStates", descriptions(linData[0].X))
+		mf.Strings("RawDescInputs", descriptions(linData[0].U))
+		mf.Strings("RawDescOutputs", descriptions(linData[0].Y))
+	}
+
+	return mf.Save(path)
+}
+
+// writeOperPointsMAT adds the operating point values, descriptions, rotating
+// frame flags, and derivative orders with the prefix.
+func writeOperPointsMAT(mf *matFile, prefix string, ops []OperPointData) {
+	values := make([]float64, len(ops))
+	rotating := make([]float64, len(ops))
+	derivOrder := make([]float64, len(ops))
+	for i, op := range ops {
+		values[i] = op.OperPoint
+		if op.IsRotating {
+			rotating[i] = 1
+		}
+		derivOrder[i] = float64(op.DerivOrder)
+	}
+	mf.Vector(prefix+"_op", values)
+	mf.Strings(prefix+"_desc", descriptions(ops))
+	mf.Vector(prefix+"_rotFrame", rotating)
+	mf.Vector(prefix+"_derivOrder", derivOrder)
+}
+
+// vecsToDense returns a matrix with the vectors as columns, or nil if there
+// are no vectors.
+func vecsToDense(vs []*mat.VecDense) *mat.Dense {
+	if len(vs) == 0 {
+		return nil
+	}
+	m := mat.NewDense(vs[0].Len(), len(vs), nil)
+	for j, v := range vs {
+		m.SetCol(j, vecToSlice(v))
+	}
+	return m
+}
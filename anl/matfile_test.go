@@ -0,0 +1,182 @@
+package anl_test
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+// matVar is a top level variable read from a MAT-file.
+type matVar struct {
+	Dims    []int
+	Data    []float64 // Double arrays
+	Strings []string  // Cell arrays of strings
+}
+
+// readMAT reads the double and cell array variables from a Level 5 MAT-file
+// written by the anl package.
+func readMAT(t *testing.T, path string) map[string]*matVar {
+	t.Helper()
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bs) < 128 || string(bs[126:128]) != "IM" || binary.LittleEndian.Uint16(bs[124:]) != 0x0100 {
+		t.Fatal("invalid MAT-file header")
+	}
+
+	// element returns the type and data of the element at the start of b and
+	// the remaining bytes.
+	element := func(b []byte) (uint32, []byte, []byte) {
+		typ, n := binary.LittleEndian.Uint32(b), int(binary.LittleEndian.Uint32(b[4:]))
+		end := 8 + n
+		if n%8 != 0 {
+			end += 8 - n%8
+		}
+		return typ, b[8 : 8+n], b[end:]
+	}
+
+	// array returns the class, dimensions, name, and remaining subelements
+	// of a matrix element.
+	array := func(b []byte) (uint32, []int, string, []byte) {
+		_, flags, b := element(b)
+		_, dimBytes, b := element(b)
+		_, name, b := element(b)
+		dims := make([]int, len(dimBytes)/4)
+		for i := range dims {
+			dims[i] = int(binary.LittleEndian.Uint32(dimBytes[4*i:]))
+		}
+		return binary.LittleEndian.Uint32(flags) & 0xff, dims, string(name), b
+	}
+
+	vars := map[string]*matVar{}
+	for b := bs[128:]; len(b) > 0; {
+		typ, data, rest := element(b)
+		b = rest
+		if typ != 14 {
+			t.Fatalf("unexpected element type %d", typ)
+		}
+		class, dims, name, sub := array(data)
+		v := &matVar{Dims: dims}
+		switch class {
+		case 6:
+			_, values, _ := element(sub)
+			v.Data = make([]float64, len(values)/8)
+			for i := range v.Data {
+				v.Data[i] = math.Float64frombits(binary.LittleEndian.Uint64(values[8*i:]))
+			}
+		case 1:
+			for len(sub) > 0 {
+				var cell []byte
+				_, cell, sub = element(sub)
+				_, _, _, chars := array(cell)
+				_, cb, _ := element(chars)
+				u := make([]uint16, len(cb)/2)
+				for i := range u {
+					u[i] = binary.LittleEndian.Uint16(cb[2*i:])
+				}
+				v.Strings = append(v.Strings, string(utf16.Decode(u)))
+			}
+		default:
+			t.Fatalf("unexpected class %d for %s", class, name)
+		}
+		vars[name] = v
+	}
+	return vars
+}
+
+func TestLinDataWriteMAT(t *testing.T) {
+
+	ld := newDrivetrainLinData(0.1, -0.2, -0.01)[1]
+	path := filepath.Join(t.TempDir(), "lin.mat")
+	if err := ld.WriteMAT(path); err != nil {
+		t.Fatal(err)
+	}
+	vars := readMAT(t, path)
+
+	if v := vars["Azimuth"]; v == nil || v.Data[0] != ld.Azimuth {
+		t.Errorf("Azimuth = %v, expected %v", v, ld.Azimuth)
+	}
+	B := vars["B"]
+	if B == nil || len(B.Dims) != 2 || B.Dims[0] != 2 || B.Dims[1] != 4 {
+		t.Fatalf("B dims = %v, expected [2 4]", B)
+	}
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			if got, exp := B.Data[i+2*j], ld.B.At(i, j); got != exp {
+				t.Errorf("B(%d,%d) = %v, expected %v", i, j, got, exp)
+			}
+		}
+	}
+	if v := vars["u_desc"]; v == nil || len(v.Strings) != 4 || v.Strings[3] != ld.U[3].Desc {
+		t.Errorf("u_desc = %v", v)
+	}
+	if v := vars["u_rotFrame"]; v == nil || v.Data[0] != 1 || v.Data[3] != 0 {
+		t.Errorf("u_rotFrame = %v, expected [1 1 1 0]", v)
+	}
+}
+
+func TestMatDataWriteMAT(t *testing.T) {
+
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "mbc.mat")
+	if err := md.WriteMAT(path); err != nil {
+		t.Fatal(err)
+	}
+	vars := readMAT(t, path)
+
+	for _, name := range []string{"A", "B", "C", "D", "RawA", "RawB", "RawC", "RawD"} {
+		v := vars[name]
+		if v == nil || len(v.Dims) != 3 || v.Dims[2] != md.NumStep {
+			t.Errorf("%s dims = %v, expected %d steps", name, v, md.NumStep)
+		}
+	}
+
+	AvgB := vars["AvgB"]
+	if AvgB == nil {
+		t.Fatal("AvgB missing")
+	}
+	r, c := md.AvgB.Dims()
+	if AvgB.Dims[0] != r || AvgB.Dims[1] != c {
+		t.Fatalf("AvgB dims = %v, expected [%d %d]", AvgB.Dims, r, c)
+	}
+	for i := 0; i < r; i++ {
+		for j := 0; j < c; j++ {
+			if got, exp := AvgB.Data[i+r*j], md.AvgB.At(i, j); got != exp {
+				t.Errorf("AvgB(%d,%d) = %v, expected %v", i, j, got, exp)
+			}
+		}
+	}
+
+	if v := vars["Azimuth"]; v == nil || len(v.Data) != md.NumStep || v.Data[1] != md.Azimuth.AtVec(1) {
+		t.Errorf("Azimuth = %v", v)
+	}
+	if v := vars["DescInputs"]; v == nil || len(v.Strings) != md.NumInputs || v.Strings[0] != md.DescInputs[0].Desc {
+		t.Errorf("DescInputs = %v", v)
+	}
+	if v := vars["RawDescInputs"]; v == nil || len(v.Strings) != 4 || v.Strings[0] != "ED Blade 1 pitch command, rad" {
+		t.Errorf("RawDescInputs = %v", v)
+	}
+}
+
+func TestMATFileSizeLimit(t *testing.T) {
+
+	// Arrays larger than the 32 bit element size are rejected without
+	// assembling the data
+	mf := anl.NewMATFile()
+	mf.Scalar("ok", 1)
+	mf.Double("big", []int{1 << 16, 1 << 16}, nil)
+	err := mf.Save(filepath.Join(t.TempDir(), "big.mat"))
+	if err == nil || !strings.Contains(err.Error(), "variable big with dimensions [65536 65536] exceeds") {
+		t.Fatalf("error = %v, expected size limit error for big", err)
+	}
+}
@@ -1,9 +1,210 @@
 package anl
 
+import (
+	"encoding/json"
+	"math"
+	"os"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// MBC contains the results of the multi-blade coordinate transformation for
+// a turbine. Matrices and descriptions are in MBC ordering. The state-space
+// matrices at each azimuth are not included; they are written to the MAT-file
+// given by Turbine.MATPath if Turbine.SaveStepMatrices is set.
 type MBC struct {
-	DescStates []string
-	NumDOF2    int
-	NumDOF1    int
-	RotSpeed   float64
-	WindSpeed  float64
+	DescStates  []string
+	DescInputs  []string
+	DescOutputs []string
+	NumBlades   int
+	NumDOF2     int
+	NumDOF1     int
+	RotSpeed    float64         // Rotor speed (rpm)
+	WindSpeed   float64         // Wind speed (m/s)
+	Azimuth     []float64       // Azimuth of each linearization (deg)
+	OmegaDot    []float64       // Rotor acceleration at each azimuth (rad/s^2)
+	AvgA        [][]float64     // Azimuth averaged state matrix
+	AvgB        [][]float64     // Azimuth averaged input matrix
+	AvgC        [][]float64     // Azimuth averaged output matrix
+	AvgD        [][]float64     // Azimuth averaged feedthrough matrix
+	AvgOpX      []float64       // Azimuth averaged state operating point
+	AvgOpXd     []float64       // Azimuth averaged state derivative operating point
+	ModeStates  []OperPointData // Descriptions of mode eigenvector rows
+	Modes       []*ModeResults
+	Floquet     *FloquetResults     // Floquet analysis results, if performed
+	Periodicity *PeriodicityResults // Residual periodicity of MBC state matrices
+	ClosedLoop  *ClosedLoopResults  // Closed loop analysis results, if performed
+}
+
+// NewMBC creates the MBC results from the transformed matrix data.
+func NewMBC(md *MatData) *MBC {
+
+	mbc := &MBC{
+		DescStates:  descriptions(md.DescStates),
+		DescInputs:  descriptions(md.DescInputs),
+		DescOutputs: descriptions(md.DescOutputs),
+		NumBlades:   md.NumBlades,
+		NumDOF2:     md.NumDOF2,
+		NumDOF1:     md.NumDOF1,
+		RotSpeed:    mat.Sum(md.Omega) / float64(md.NumStep) * 30 / math.Pi,
+		WindSpeed:   mat.Sum(md.WindSpeed) / float64(md.NumStep),
+		Azimuth:     vecToSlice(md.Azimuth),
+		OmegaDot:    vecToSlice(md.OmegaDot),
+		AvgA:        denseToSlice(md.AvgA),
+		AvgB:        denseToSlice(md.AvgB),
+		AvgC:        denseToSlice(md.AvgC),
+		AvgD:        denseToSlice(md.AvgD),
+		AvgOpX:      vecToSlice(md.AvgOpX),
+		AvgOpXd:     vecToSlice(md.AvgOpXd),
+		ModeStates:  md.ModeStates,
+		Modes:       md.Modes,
+		Floquet:     md.Floquet,
+		Periodicity: md.Periodicity,
+		ClosedLoop:  md.ClosedLoop,
+	}
+
+	return mbc
+}
+
+// ReadMBC reads MBC results from a JSON file written by MBC.Write.
+func ReadMBC(path string) (*MBC, error) {
+
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	mbc := &MBC{}
+	if err := json.Unmarshal(bs, mbc); err != nil {
+		return nil, err
+	}
+
+	return mbc, nil
+}
+
+// Write saves the MBC results to a JSON file.
+func (mbc *MBC) Write(path string) error {
+
+	bs, err := json.Marshal(mbc)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, bs, 0777)
+}
+
+// MarshalJSON encodes the complex eigenvalue, eigenvector, and shapes as
+// [real, imag] pairs because complex numbers aren't supported by encoding/json.
+func (m *ModeResults) MarshalJSON() ([]byte, error) {
+	type modeResults ModeResults
+	periodicShapes := make([][][2]float64, len(m.PeriodicShapes))
+	for i, shape := range m.PeriodicShapes {
+		periodicShapes[i] = complexesToPairs(shape)
+	}
+	return json.Marshal(&struct {
+		*modeResults
+		EigenValue     [2]float64
+		EigenVector    [][2]float64
+		ShapeComplex   [][2]float64
+		PeriodicShapes [][][2]float64 `json:",omitempty"`
+	}{
+		modeResults:    (*modeResults)(m),
+		EigenValue:     complexToPair(m.EigenValue),
+		EigenVector:    complexesToPairs(m.EigenVector),
+		ShapeComplex:   complexesToPairs(m.ShapeComplex),
+		PeriodicShapes: periodicShapes,
+	})
+}
+
+// UnmarshalJSON decodes mode results encoded by MarshalJSON.
+func (m *ModeResults) UnmarshalJSON(data []byte) error {
+	type modeResults ModeResults
+	aux := &struct {
+		*modeResults
+		EigenValue     [2]float64
+		EigenVector    [][2]float64
+		ShapeComplex   [][2]float64
+		PeriodicShapes [][][2]float64
+	}{
+		modeResults: (*modeResults)(m),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	m.EigenValue = complex(aux.EigenValue[0], aux.EigenValue[1])
+	m.EigenVector = pairsToComplexes(aux.EigenVector)
+	m.ShapeComplex = pairsToComplexes(aux.ShapeComplex)
+	m.PeriodicShapes = nil
+	for _, shape := range aux.PeriodicShapes {
+		m.PeriodicShapes = append(m.PeriodicShapes, pairsToComplexes(shape))
+	}
+	return nil
+}
+
+func descriptions(ops []OperPointData) []string {
+	desc := make([]string, len(ops))
+	for i, op := range ops {
+		desc[i] = op.Desc
+	}
+	return desc
+}
+
+func complexToPair(c complex128) [2]float64 {
+	return [2]float64{real(c), imag(c)}
+}
+
+func complexesToPairs(cs []complex128) [][2]float64 {
+	if cs == nil {
+		return nil
+	}
+	pairs := make([][2]float64, len(cs))
+	for i, c := range cs {
+		pairs[i] = complexToPair(c)
+	}
+	return pairs
+}
+
+func pairsToComplexes(pairs [][2]float64) []complex128 {
+	if pairs == nil {
+		return nil
+	}
+	cs := make([]complex128, len(pairs))
+	for i, p := range pairs {
+		cs[i] = complex(p[0], p[1])
+	}
+	return cs
+}
+
+func vecToSlice(v *mat.VecDense) []float64 {
+	if v == nil {
+		return nil
+	}
+	s := make([]float64, v.Len())
+	for i := range s {
+		s[i] = v.AtVec(i)
+	}
+	return s
+}
+
+func denseToSlice(m *mat.Dense) [][]float64 {
+	if m == nil || m.IsEmpty() {
+		return nil
+	}
+	r, _ := m.Dims()
+	s := make([][]float64, r)
+	for i := range s {
+		s[i] = mat.Row(nil, i, m)
+	}
+	return s
+}
+
+func sliceToDense(s [][]float64) *mat.Dense {
+	if len(s) == 0 || len(s[0]) == 0 {
+		return nil
+	}
+	m := mat.NewDense(len(s), len(s[0]), nil)
+	for i, row := range s {
+		m.SetRow(i, row)
+	}
+	return m
 }
@@ -0,0 +1,54 @@
+package anl_test
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestMBCWriteRead(t *testing.T) {
+
+	ts := newTestSystem(3, 1.2, []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2})
+
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mbc := anl.NewMBC(md)
+
+	if math.Abs(mbc.RotSpeed-1.2*30/math.Pi) > 1e-12 {
+		t.Fatalf("RotSpeed = %v, expected %v", mbc.RotSpeed, 1.2*30/math.Pi)
+	}
+
+	expDesc := []string{
+		"ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m",
+		"ED 1st flapwise bending-mode DOF of blade collective (internal DOF index = DOF_BF(1,1)), m",
+		"ED 1st flapwise bending-mode DOF of blade cosine (internal DOF index = DOF_BF(2,1)), m",
+		"ED 1st flapwise bending-mode DOF of blade sine (internal DOF index = DOF_BF(3,1)), m",
+	}
+	if !reflect.DeepEqual(mbc.DescStates[:4], expDesc) {
+		t.Fatalf("DescStates = %q, expected %q", mbc.DescStates[:4], expDesc)
+	}
+	if !strings.HasSuffix(mbc.DescInputs[3], "Blade sine pitch command, rad") {
+		t.Fatalf("DescInputs[3] = %q", mbc.DescInputs[3])
+	}
+
+	path := filepath.Join(t.TempDir(), "turb_01.mbc.json")
+	if err := mbc.Write(path); err != nil {
+		t.Fatal(err)
+	}
+
+	act, err := anl.ReadMBC(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(act, mbc) {
+		t.Fatalf("MBC read from file doesn't match MBC written to file")
+	}
+}
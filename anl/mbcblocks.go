@@ -0,0 +1,378 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// mbcBlocks describes the structure of the multi-blade coordinate
+// transformation in MBC ordering. The fixed frame entries of each group of
+// states, inputs, and outputs come first, followed by the blade triplets, so
+// the transformation matrices (eq. 11-15) are block diagonal with identity or
+// zero entries for the fixed frame and numBlades x numBlades blocks for the
+// triplets. The transformation is applied block by block and the permutations
+// as index maps, so the cost per azimuth is O(n^2*numBlades) instead of the
+// O(n^3) of full size matrix products, and no full size transformation
+// matrices are allocated.
+type mbcBlocks struct {
+	numBlades int
+	q, qd, x1 []int // Start of each triplet of displacement, velocity, and first order states
+	u, y      []int // Start of each input and output triplet
+	permX     []int // Linearization file index of each state in MBC ordering
+	permU     []int // Linearization file index of each input in MBC ordering
+	permY     []int // Linearization file index of each output in MBC ordering
+}
+
+// newMBCBlocks returns the transformation structure for the matrix data with
+// the given state permutation, which combines the second and first order
+// state permutations.
+func newMBCBlocks(md *MatData, permuteStates []int) *mbcBlocks {
+
+	nb := md.NumBlades
+	starts := func(offset, numFixed, numTriplets int) []int {
+		s := make([]int, numTriplets)
+		for k := range s {
+			s[k] = offset + numFixed + k*nb
+		}
+		return s
+	}
+
+	rot := md.Rotation
+	numFix2 := md.NumDOF2 - len(rot.TripletsStates2)*nb
+	numFix1 := md.NumDOF1 - len(rot.TripletsStates1)*nb
+	return &mbcBlocks{
+		numBlades: nb,
+		q:         starts(0, numFix2, len(rot.TripletsStates2)),
+		qd:        starts(md.NumDOF2, numFix2, len(rot.TripletsStates2)),
+		x1:        starts(md.NumStates2, numFix1, len(rot.TripletsStates1)),
+		u:         starts(0, md.NumInputs-len(rot.TripletsInputs)*nb, len(rot.TripletsInputs)),
+		y:         starts(0, md.NumOutputs-len(rot.TripletsOutputs)*nb, len(rot.TripletsOutputs)),
+		permX:     permuteStates,
+		permU:     rot.PermuteInputs,
+		permY:     rot.PermuteOutputs,
+	}
+}
+
+// transformSteps transforms the linearization data at each azimuth step into
+// the nonrotating frame, running steps in parallel on up to numWorkers
+// goroutines, one if numWorkers is less than one. Dimensions must have been
+// checked by checkStepDims. As a last resort, a panic while transforming a
+// step is returned as an error for the first such step rather than
+// terminating the process.
+func (b *mbcBlocks) transformSteps(md *MatData, numWorkers int, omegaDots []float64,
+	opXRot, opXdRot []*mat.VecDense) error {
+
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+	if numWorkers > md.NumStep {
+		numWorkers = md.NumStep
+	}
+
+	steps := make(chan int)
+	errs := make([]error, md.NumStep)
+	wg := sync.WaitGroup{}
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range steps {
+				errs[i] = b.safeTransformStep(md, i, omegaDots[i], opXRot, opXdRot)
+			}
+		}()
+	}
+	for i := 0; i < md.NumStep; i++ {
+		steps <- i
+	}
+	close(steps)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// safeTransformStep calls transformStep and returns an error identifying the
+// step and its linearization file if it panics.
+func (b *mbcBlocks) safeTransformStep(md *MatData, i int, omegaDot float64,
+	opXRot, opXdRot []*mat.VecDense) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ld := md.LinData[i]
+			err = fmt.Errorf("error transforming linearization %d at azimuth %.2f deg from '%s': %v",
+				i+1, ld.Azimuth*180/math.Pi, ld.FilePath, r)
+		}
+	}()
+	b.transformStep(md, i, omegaDot, opXRot, opXdRot)
+	return nil
+}
+
+// transformStep transforms the state-space matrices and operating points of
+// step i into the nonrotating frame. Only data for step i is written, so
+// steps may be transformed concurrently.
+func (b *mbcBlocks) transformStep(md *MatData, i int, omegaDot float64,
+	opXRot, opXdRot []*mat.VecDense) {
+
+	ld := md.LinData[i]
+
+	// Rotor speed in radians/sec and rotor speed squared
+	omega := ld.RotorSpeed
+	omega2 := omega * omega
+
+	md.Omega.SetVec(i, omega)
+	md.OmegaDot.SetVec(i, omegaDot)
+	md.Azimuth.SetVec(i, ld.Azimuth*180/math.Pi)
+	md.WindSpeed.SetVec(i, ld.WindSpeed)
+
+	// Eq. 9 and 16, t_tilde, its inverse, and azimuth derivatives
+	tt, ttv, tt2, tt3 := bladeTransforms(b.numBlades, ld.Azimuth)
+
+	// Eq. 29, A matrix in nonrotating frame, Lv*(A*L - R)
+	if md.NumStates > 0 {
+		A := permuted(ld.A, b.permX, b.permX)
+		b.mulL(A, omega, tt, tt2)
+		blockAdd(A, b.q, b.q, -omega, tt2)
+		blockAdd(A, b.qd, b.qd, -2*omega, tt2)
+		blockAdd(A, b.qd, b.q, -omega2, tt3)
+		blockAdd(A, b.qd, b.q, -omegaDot, tt2)
+		blockAdd(A, b.x1, b.x1, -omega, tt2)
+		b.mulLv(A, ttv)
+		md.A[i] = A
+	}
+
+	// Eq. 30, B matrix in nonrotating frame, Lv*B*T1c
+	if md.B != nil {
+		B := permuted(ld.B, b.permX, b.permU)
+		b.mulLv(B, ttv)
+		blockMulRight(B, b.u, tt)
+		md.B[i] = B
+	}
+
+	// Eq. 31, C matrix in nonrotating frame, T1ov*C*L
+	if md.C != nil {
+		C := permuted(ld.C, b.permY, b.permX)
+		b.mulL(C, omega, tt, tt2)
+		blockMulLeft(C, b.y, ttv)
+		md.C[i] = C
+	}
+
+	// Eq. 32, D matrix in nonrotating frame, T1ov*D*T1c
+	if md.D != nil {
+		D := permuted(ld.D, b.permY, b.permU)
+		blockMulLeft(D, b.y, ttv)
+		blockMulRight(D, b.u, tt)
+		md.D[i] = D
+	}
+
+	// Eq. 10, operating points in MBC ordering and nonrotating frame
+	if md.NumStates > 0 {
+		b.nonrotatingOperPoints(opXRot[i], opXdRot[i], md.OpX[i], md.OpXd[i],
+			omega, omegaDot, ttv, tt2, tt3)
+	}
+}
+
+// mulL multiplies m on the right by the state transformation L, which has
+// T1 blocks on the diagonal for the displacements and velocities, T1q blocks
+// for the first order states, and omega*T2 blocks coupling the velocity
+// rows to the displacement columns.
+func (b *mbcBlocks) mulL(m *mat.Dense, omega float64, tt, tt2 *mat.Dense) {
+	blockMulRight(m, b.q, tt)
+	blockMulAddRight(m, b.q, b.qd, omega, tt2) // Uses velocity columns before transformation
+	blockMulRight(m, b.qd, tt)
+	blockMulRight(m, b.x1, tt)
+}
+
+// mulLv multiplies m on the left by the inverse state transformation, which
+// has T1v blocks on the diagonal.
+func (b *mbcBlocks) mulLv(m *mat.Dense, ttv *mat.Dense) {
+	blockMulLeft(m, b.q, ttv)
+	blockMulLeft(m, b.qd, ttv)
+	blockMulLeft(m, b.x1, ttv)
+}
+
+// nonrotatingOperPoints transforms the rotating frame state and state
+// derivative operating points (x, xd), which are in linearization file
+// ordering, into the nonrotating frame operating points (z, zd) in MBC
+// ordering by inverting x = L*z and its time derivative.
+func (b *mbcBlocks) nonrotatingOperPoints(x, xd, z, zd *mat.VecDense,
+	omega, omegaDot float64, ttv, tt2, tt3 *mat.Dense) {
+
+	for i, p := range b.permX {
+		z.SetVec(i, x.AtVec(p))
+		zd.SetVec(i, xd.AtVec(p))
+	}
+	zm := mat.NewDense(z.Len(), 1, z.RawVector().Data)
+	zdm := mat.NewDense(zd.Len(), 1, zd.RawVector().Data)
+
+	// Displacements, q = T1*z_q
+	blockMulLeft(zm, b.q, ttv)
+
+	// Velocities, qd = omega*T2*z_q + T1*z_qd
+	blockMulAddLeft(zm, b.qd, zm, b.q, -omega, tt2)
+	blockMulLeft(zm, b.qd, ttv)
+
+	// Displacement derivatives, same form as velocities
+	blockMulAddLeft(zdm, b.q, zm, b.q, -omega, tt2)
+	blockMulLeft(zdm, b.q, ttv)
+
+	// Velocity derivatives, qdd = (omega^2*T3 + omegaDot*T2)*z_q +
+	// omega*T2*(z_qd + zd_q) + T1*zd_qd
+	blockMulAddLeft(zdm, b.qd, zm, b.q, -omega*omega, tt3)
+	blockMulAddLeft(zdm, b.qd, zm, b.q, -omegaDot, tt2)
+	blockMulAddLeft(zdm, b.qd, zm, b.qd, -omega, tt2)
+	blockMulAddLeft(zdm, b.qd, zdm, b.q, -omega, tt2)
+	blockMulLeft(zdm, b.qd, ttv)
+
+	// First order states, x1 = T1q*z1, xd1 = omega*T2q*z1 + T1q*zd1
+	blockMulLeft(zm, b.x1, ttv)
+	blockMulAddLeft(zdm, b.x1, zm, b.x1, -omega, tt2)
+	blockMulLeft(zdm, b.x1, ttv)
+}
+
+// permuted returns a copy of m with row i from row rowPerm[i] and column j
+// from column colPerm[j] of m, equivalent to P*m*Q' for permutation matrices.
+func permuted(m *mat.Dense, rowPerm, colPerm []int) *mat.Dense {
+	out := mat.NewDense(len(rowPerm), len(colPerm), nil)
+	raw, rawOut := m.RawMatrix(), out.RawMatrix()
+	for i, r := range rowPerm {
+		src := raw.Data[r*raw.Stride : r*raw.Stride+raw.Cols]
+		dst := rawOut.Data[i*rawOut.Stride : i*rawOut.Stride+rawOut.Cols]
+		for j, c := range colPerm {
+			dst[j] = src[c]
+		}
+	}
+	return out
+}
+
+// blockMulRight replaces the columns of each block of m with the block
+// multiplied on the right by b, m[:, s:s+nb] = m[:, s:s+nb]*b for each start s.
+func blockMulRight(m *mat.Dense, starts []int, b *mat.Dense) {
+	if len(starts) == 0 {
+		return
+	}
+	nb, _ := b.Dims()
+	raw, rb := m.RawMatrix(), b.RawMatrix()
+	tmp := make([]float64, nb)
+	for r := 0; r < raw.Rows; r++ {
+		row := raw.Data[r*raw.Stride : r*raw.Stride+raw.Cols]
+		for _, s := range starts {
+			blk := row[s : s+nb]
+			for j := range tmp {
+				sum := 0.0
+				for k, v := range blk {
+					sum += v * rb.Data[k*rb.Stride+j]
+				}
+				tmp[j] = sum
+			}
+			copy(blk, tmp)
+		}
+	}
+}
+
+// blockMulAddRight adds the columns of each source block of m multiplied on
+// the right by alpha*b to the corresponding destination block,
+// m[:, d:d+nb] += alpha*m[:, s:s+nb]*b for each pair of starts.
+func blockMulAddRight(m *mat.Dense, dst, src []int, alpha float64, b *mat.Dense) {
+	if len(dst) == 0 || alpha == 0 {
+		return
+	}
+	nb, _ := b.Dims()
+	raw, rb := m.RawMatrix(), b.RawMatrix()
+	for r := 0; r < raw.Rows; r++ {
+		row := raw.Data[r*raw.Stride : r*raw.Stride+raw.Cols]
+		for t, s := range src {
+			d := dst[t]
+			for j := 0; j < nb; j++ {
+				sum := 0.0
+				for k := 0; k < nb; k++ {
+					sum += row[s+k] * rb.Data[k*rb.Stride+j]
+				}
+				row[d+j] += alpha * sum
+			}
+		}
+	}
+}
+
+// blockMulLeft replaces the rows of each block of m with the block multiplied
+// on the left by b, m[s:s+nb, :] = b*m[s:s+nb, :] for each start s.
+func blockMulLeft(m *mat.Dense, starts []int, b *mat.Dense) {
+	if len(starts) == 0 {
+		return
+	}
+	nb, _ := b.Dims()
+	raw, rb := m.RawMatrix(), b.RawMatrix()
+	tmp := make([]float64, nb*raw.Cols)
+	for _, s := range starts {
+		for i := 0; i < nb; i++ {
+			out := tmp[i*raw.Cols : (i+1)*raw.Cols]
+			for j := range out {
+				out[j] = 0
+			}
+			for k := 0; k < nb; k++ {
+				bik := rb.Data[i*rb.Stride+k]
+				if bik == 0 {
+					continue
+				}
+				row := raw.Data[(s+k)*raw.Stride : (s+k)*raw.Stride+raw.Cols]
+				for j, v := range row {
+					out[j] += bik * v
+				}
+			}
+		}
+		for i := 0; i < nb; i++ {
+			copy(raw.Data[(s+i)*raw.Stride:(s+i)*raw.Stride+raw.Cols], tmp[i*raw.Cols:(i+1)*raw.Cols])
+		}
+	}
+}
+
+// blockMulAddLeft adds the rows of each source block of src multiplied on the
+// left by alpha*b to the corresponding destination block of m,
+// m[d:d+nb, :] += alpha*b*src[s:s+nb, :] for each pair of starts. The
+// destination and source blocks must not overlap.
+func blockMulAddLeft(m *mat.Dense, dst []int, src *mat.Dense, srcStarts []int, alpha float64, b *mat.Dense) {
+	if len(dst) == 0 || alpha == 0 {
+		return
+	}
+	nb, _ := b.Dims()
+	raw, rs, rb := m.RawMatrix(), src.RawMatrix(), b.RawMatrix()
+	for t, s := range srcStarts {
+		d := dst[t]
+		for i := 0; i < nb; i++ {
+			out := raw.Data[(d+i)*raw.Stride : (d+i)*raw.Stride+raw.Cols]
+			for k := 0; k < nb; k++ {
+				bik := alpha * rb.Data[i*rb.Stride+k]
+				if bik == 0 {
+					continue
+				}
+				row := rs.Data[(s+k)*rs.Stride : (s+k)*rs.Stride+rs.Cols]
+				for j, v := range row {
+					out[j] += bik * v
+				}
+			}
+		}
+	}
+}
+
+// blockAdd adds alpha*b to the block of m at each pair of row and column
+// starts.
+func blockAdd(m *mat.Dense, rows, cols []int, alpha float64, b *mat.Dense) {
+	if alpha == 0 {
+		return
+	}
+	nb, _ := b.Dims()
+	raw, rb := m.RawMatrix(), b.RawMatrix()
+	for t, r := range rows {
+		c := cols[t]
+		for i := 0; i < nb; i++ {
+			for j := 0; j < nb; j++ {
+				raw.Data[(r+i)*raw.Stride+c+j] += alpha * rb.Data[i*rb.Stride+j]
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package anl
+
+import (
+	"fmt"
+	"math/cmplx"
+	"regexp"
+	"strings"
+)
+
+// Rules for converting state descriptions into mode names, the first matching
+// rule is used and the name may reference submatches of the expression.
+var modeNameRules = []struct {
+	re   *regexp.Regexp
+	name string
+}{
+	{regexp.MustCompile(`(?i)(\d+(?:st|nd|rd|th)) tower fore-aft`), "$1 tower fore-aft"},
+	{regexp.MustCompile(`(?i)(\d+(?:st|nd|rd|th)) tower side-to-side`), "$1 tower side-side"},
+	{regexp.MustCompile(`(?i)(\d+(?:st|nd|rd|th)) flapwise`), "$1 flap"},
+	{regexp.MustCompile(`(?i)(\d+(?:st|nd|rd|th)) edgewise`), "$1 edge"},
+	{regexp.MustCompile(`(?i)drivetrain rotational-flexibility`), "drivetrain torsion"},
+	{regexp.MustCompile(`(?i)variable speed generator`), "generator rotation"},
+	{regexp.MustCompile(`(?i)nacelle yaw`), "nacelle yaw"},
+	{regexp.MustCompile(`(?i)hub teeter`), "teeter"},
+	{regexp.MustCompile(`(?i)rotor-furl`), "rotor furl"},
+	{regexp.MustCompile(`(?i)tail-furl`), "tail furl"},
+	{regexp.MustCompile(`(?i)platform (?:horizontal |vertical )?(surge|sway|heave|roll|pitch|yaw)`), "platform $1"},
+}
+
+// modeName returns a name for the mode based on the state with the largest
+// eigenvector magnitude. If the state is an MBC coordinate, the role of the
+// coordinate is appended to the name: collective, differential, or the whirl
+// direction determined from the cosine and sine components.
+func modeName(desc []OperPointData, vec []complex128) string {
+
+	if len(desc) == 0 || len(desc) != len(vec) {
+		return ""
+	}
+
+	// Find state with largest magnitude
+	iMax := 0
+	for i, v := range vec {
+		if cmplx.Abs(v) > cmplx.Abs(vec[iMax]) {
+			iMax = i
+		}
+	}
+
+	name := stateLabel(desc[iMax].Desc)
+
+	// Add MBC coordinate role to name
+	key := ParseDesc(desc[iMax].Desc)
+	switch key.Coord {
+	case "":
+	case "collective", "differential":
+		name += " " + key.Coord
+	default:
+		// Find cosine and sine components of this state to get whirl
+		// direction, the internal DOF differs between the components
+		harmonic := strings.TrimPrefix(strings.TrimPrefix(key.Coord, "cosine"), "sine")
+		key.DOF = ""
+		var cosVal, sinVal complex128
+		for i, d := range desc {
+			cd := ParseDesc(d.Desc)
+			coord := cd.Coord
+			cd.Coord, cd.DOF = key.Coord, ""
+			if cd != key {
+				continue
+			}
+			switch coord {
+			case "cosine" + harmonic:
+				cosVal = vec[i]
+			case "sine" + harmonic:
+				sinVal = vec[i]
+			}
+		}
+		if fwd, bwd := whirlAmplitudes(cosVal, sinVal); fwd >= bwd {
+			name += " forward whirl"
+		} else {
+			name += " backward whirl"
+		}
+	}
+
+	return name
+}
+
+// stateLabel returns a short label for the state description by applying the
+// mode name rules. If no rule matches, the label is the quantity of the parsed
+// description with its blade and node number, so the module, internal DOF,
+// MBC coordinate, and units are omitted.
+func stateLabel(desc string) string {
+
+	for _, rule := range modeNameRules {
+		if m := rule.re.FindString(desc); m != "" {
+			return rule.re.ReplaceAllString(m, rule.name)
+		}
+	}
+
+	cd := ParseDesc(desc)
+	label := cd.Quantity
+	if cd.Deriv > 0 {
+		label = derivPrefixes[cd.Deriv-1] + label
+	}
+	if cd.Blade > 0 {
+		label += fmt.Sprintf(" of blade %d", cd.Blade)
+	}
+	if cd.Node > 0 {
+		label += fmt.Sprintf(" node %d", cd.Node)
+	}
+
+	return label
+}
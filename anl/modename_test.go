@@ -0,0 +1,69 @@
+package anl_test
+
+import (
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestModeName(t *testing.T) {
+
+	desc := []anl.OperPointData{
+		{Desc: "ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m"},
+		{Desc: "ED Drivetrain rotational-flexibility DOF (internal DOF index = DOF_DrTr), rad"},
+		{Desc: "ED 1st flapwise bending-mode DOF of blade collective (internal DOF index = DOF_BF(1,1)), m"},
+		{Desc: "ED 1st flapwise bending-mode DOF of blade cosine (internal DOF index = DOF_BF(2,1)), m"},
+		{Desc: "ED 1st flapwise bending-mode DOF of blade sine (internal DOF index = DOF_BF(3,1)), m"},
+		{Desc: "ED 1st edgewise bending-mode DOF of blade collective (internal DOF index = DOF_BE(1,1)), m"},
+		{Desc: "ED 1st edgewise bending-mode DOF of blade cosine (internal DOF index = DOF_BE(2,1)), m"},
+		{Desc: "ED 1st edgewise bending-mode DOF of blade sine (internal DOF index = DOF_BE(3,1)), m"},
+	}
+
+	testCases := []struct {
+		vec []complex128
+		exp string
+	}{
+		{vec: []complex128{1, 0.1, 0.2, 0, 0, 0, 0, 0}, exp: "1st tower fore-aft"},
+		{vec: []complex128{0.1, 1i, 0, 0, 0, 0.2, 0, 0}, exp: "drivetrain torsion"},
+		{vec: []complex128{0.1, 0, 1, 0, 0, 0, 0, 0}, exp: "1st flap collective"},
+		{vec: []complex128{0, 0, 0, 0, 0, 0, 1, -1i}, exp: "1st edge forward whirl"},
+		{vec: []complex128{0, 0, 0, 0, 0, 0, 1, 1i}, exp: "1st edge backward whirl"},
+		{vec: []complex128{0, 0, 0, 0.5i, -1, 0, 0, 0}, exp: "1st flap backward whirl"},
+	}
+
+	for _, tc := range testCases {
+		if act := anl.ModeName(desc, tc.vec); act != tc.exp {
+			t.Errorf("ModeName(%v) = %q, expected %q", tc.vec, act, tc.exp)
+		}
+	}
+}
+
+func TestModeNameBeamDyn(t *testing.T) {
+
+	// BeamDyn states have no mode name rule, so the name is built from the
+	// parsed description, and the whirl direction uses the sine component at
+	// the same node
+	desc := []anl.OperPointData{
+		{Desc: "BD_collective Node 5 translational displacement in X, m"},
+		{Desc: "BD_cosine Node 5 translational displacement in X, m"},
+		{Desc: "BD_sine Node 5 translational displacement in X, m"},
+		{Desc: "BD_collective Node 6 translational displacement in X, m"},
+		{Desc: "BD_cosine Node 6 translational displacement in X, m"},
+		{Desc: "BD_sine Node 6 translational displacement in X, m"},
+	}
+
+	testCases := []struct {
+		vec []complex128
+		exp string
+	}{
+		{vec: []complex128{1, 0, 0, 0.5, 0, 0}, exp: "translational displacement in X node 5 collective"},
+		{vec: []complex128{0, 1, -1i, 0, 0.5, 0.5i}, exp: "translational displacement in X node 5 forward whirl"},
+		{vec: []complex128{0, 0.5, -0.5i, 0, 1, 1i}, exp: "translational displacement in X node 6 backward whirl"},
+	}
+
+	for _, tc := range testCases {
+		if act := anl.ModeName(desc, tc.vec); act != tc.exp {
+			t.Errorf("ModeName(%v) = %q, expected %q", tc.vec, act, tc.exp)
+		}
+	}
+}
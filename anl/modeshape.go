@@ -0,0 +1,115 @@
+package anl
+
+import (
+	"math/cmplx"
+)
+
+// WhirlResults contains the decomposition of the nonrotating blade
+// coordinates of a state triplet in a mode into collective, forward whirl,
+// and backward whirl components.
+type WhirlResults struct {
+	Label      string  // Label of the triplet state
+	Collective float64 // Collective amplitude
+	Forward    float64 // Forward whirl amplitude
+	Backward   float64 // Backward whirl amplitude
+	Direction  string  // Dominant whirl direction, "forward" or "backward"
+}
+
+// bladeWhirl returns the whirl decomposition of each blade state triplet in
+// the eigenvector, which is in MBC ordering. Rotors with fewer than three
+// blades don't have cosine and sine coordinates, so no results are returned.
+func bladeWhirl(md *MatData, eigvec []complex128) []WhirlResults {
+
+	n := md.NumBlades
+	if n < 3 || len(md.DescStates) != md.NumStates {
+		return nil
+	}
+
+	// Rows of the first triplet of the displacement and first order states
+	starts := []int{md.NumDOF2 - len(md.Rotation.TripletsStates2)*n}
+	numTriplets := []int{len(md.Rotation.TripletsStates2)}
+	if md.NumDOF1 > 0 {
+		starts = append(starts, md.NumStates-len(md.Rotation.TripletsStates1)*n)
+		numTriplets = append(numTriplets, len(md.Rotation.TripletsStates1))
+	}
+
+	results := []WhirlResults{}
+	for k, start := range starts {
+		for t := 0; t < numTriplets[k]; t++ {
+			r := start + t*n
+			fwd, bwd := whirlAmplitudes(eigvec[r+1], eigvec[r+2])
+			wr := WhirlResults{
+				Label:      stateLabel(md.DescStates[r].Desc),
+				Collective: cmplx.Abs(eigvec[r]),
+				Forward:    fwd,
+				Backward:   bwd,
+				Direction:  "forward",
+			}
+			if bwd > fwd {
+				wr.Direction = "backward"
+			}
+			results = append(results, wr)
+		}
+	}
+
+	return results
+}
+
+// whirlAmplitudes returns the forward and backward whirl amplitudes of the
+// cosine and sine components of an MBC eigenvector. For a mode where
+// q_c = Re(c*exp(i*w*t)) and q_s = Re(s*exp(i*w*t)), the blade displacements
+// q_c*cos(psi) + q_s*sin(psi) are the sum of a pattern rotating with the
+// rotor (forward) with amplitude |c + i*s|/2 and a pattern rotating against
+// the rotor (backward) with amplitude |c - i*s|/2.
+func whirlAmplitudes(c, s complex128) (fwd, bwd float64) {
+	return cmplx.Abs(c+1i*s) / 2, cmplx.Abs(c-1i*s) / 2
+}
+
+// normalizeShape returns the eigenvector rotated so the entry with the
+// largest magnitude is real and positive, with each entry divided by the
+// largest magnitude of the entries which have the same units. This allows
+// translational and rotational states to be compared in the mode shape. If
+// descriptions aren't available, all entries are treated as having the same
+// units.
+func normalizeShape(desc []OperPointData, vec []complex128) []complex128 {
+
+	shape := make([]complex128, len(vec))
+	if len(vec) == 0 {
+		return shape
+	}
+
+	// Get units of each entry
+	units := make([]string, len(vec))
+	if len(desc) == len(vec) {
+		for i, d := range desc {
+			units[i] = ParseDesc(d.Desc).Unit
+		}
+	}
+
+	// Find maximum magnitude for each unit and overall
+	maxMag := map[string]float64{}
+	iMax := 0
+	for i, v := range vec {
+		unit := units[i]
+		if a := cmplx.Abs(v); a > maxMag[unit] {
+			maxMag[unit] = a
+		}
+		if cmplx.Abs(v) > cmplx.Abs(vec[iMax]) {
+			iMax = i
+		}
+	}
+
+	// Phase rotation which makes the largest entry real
+	rot := complex(1, 0)
+	if a := cmplx.Abs(vec[iMax]); a > 0 {
+		rot = cmplx.Conj(vec[iMax]) / complex(a, 0)
+	}
+
+	for i, v := range vec {
+		if m := maxMag[units[i]]; m > 0 {
+			shape[i] = v * rot / complex(m, 0)
+		}
+	}
+
+	return shape
+}
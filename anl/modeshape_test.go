@@ -0,0 +1,51 @@
+package anl_test
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestModeWhirl(t *testing.T) {
+
+	ts := newTestSystem(3, 1.2, []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2})
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range md.Modes {
+		if len(mode.Whirl) != 1 {
+			t.Fatalf("len(Whirl) = %d, expected 1", len(mode.Whirl))
+		}
+		w := mode.Whirl[0]
+		if w.Label != "1st flap" {
+			t.Fatalf("Whirl label = %q, expected %q", w.Label, "1st flap")
+		}
+		if (w.Forward > w.Backward) != (w.Direction == "forward") {
+			t.Fatalf("Whirl direction %q inconsistent with amplitudes %v, %v",
+				w.Direction, w.Forward, w.Backward)
+		}
+	}
+}
+
+func TestNormalizeShape(t *testing.T) {
+
+	desc := []anl.OperPointData{
+		{Desc: "ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m"},
+		{Desc: "ED Nacelle yaw DOF (internal DOF index = DOF_Yaw), rad"},
+		{Desc: "ED 1st tower side-to-side bending mode DOF (internal DOF index = DOF_TSS1), m"},
+	}
+	vec := []complex128{2i, 0.01, -1i}
+
+	shape := anl.NormalizeShape(desc, vec)
+
+	exp := []complex128{1, -1i, -0.5}
+	for i := range exp {
+		if cmplx.Abs(shape[i]-exp[i]) > 1e-12 {
+			t.Fatalf("shape = %v, expected %v", shape, exp)
+		}
+	}
+}
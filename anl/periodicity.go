@@ -0,0 +1,123 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// DefaultPeriodicityThreshold is the ratio of harmonic to mean content in a
+// block of the MBC state matrix above which the averaged state matrix is
+// considered questionable.
+const DefaultPeriodicityThreshold = 0.1
+
+// numPeriodicityHarmonics is the number of rotor harmonics (1P, 2P, 3P)
+// reported by the residual periodicity diagnostics.
+const numPeriodicityHarmonics = 3
+
+// periodicityZeroTol is the ratio of the block mean to the state matrix mean
+// below which the block mean is considered zero.
+const periodicityZeroTol = 1e-12
+
+// PeriodicityResults contains the harmonic decomposition of the MBC state
+// matrices over azimuth. Harmonics are only reported when there are enough
+// azimuth samples to resolve them.
+type PeriodicityResults struct {
+	Threshold float64            // Ratio above which a block is flagged
+	MaxRatio  float64            // Maximum harmonic ratio over all blocks
+	Flagged   bool               // True if any block is flagged
+	Blocks    []PeriodicityBlock // Results for each block of the state matrix
+}
+
+// PeriodicityBlock contains the harmonic content of one block of the MBC
+// state matrix. Rows and columns are given as [start, end) state indices.
+type PeriodicityBlock struct {
+	Name      string
+	Rows      [2]int
+	Cols      [2]int
+	Mean      float64   // Frobenius norm of the mean of the block over azimuth
+	Harmonics []float64 // Frobenius norm of 1P, 2P, ... content relative to mean
+	Flagged   bool      // True if any harmonic exceeds the threshold
+}
+
+// residualPeriodicity performs a Fourier decomposition of the MBC state
+// matrices over azimuth and reports the magnitude of the 1P, 2P, and 3P
+// content of each block relative to its mean. Blocks are the combinations of
+// second order displacement, second order velocity, and first order states.
+// If a block has a negligible mean, the harmonics are relative to the mean of the
+// full state matrix instead. The Fourier series is fit by least squares, as
+// for the periodic model, so the azimuths don't need to be evenly spaced. A
+// threshold <= 0 uses the default.
+func residualPeriodicity(md *MatData, threshold float64) (*PeriodicityResults, error) {
+
+	if threshold <= 0 {
+		threshold = DefaultPeriodicityThreshold
+	}
+
+	pr := &PeriodicityResults{Threshold: threshold}
+
+	// Number of harmonics which can be resolved by the azimuth samples
+	numHarmonics := (md.NumStep - 1) / 2
+	if numHarmonics > numPeriodicityHarmonics {
+		numHarmonics = numPeriodicityHarmonics
+	}
+
+	// Mean, sine, and cosine coefficients of each harmonic of the state matrix
+	fm, err := fitFourierMatrix(fourierBasisQR(md.Azimuth, numHarmonics), numHarmonics, md.A)
+	if err != nil {
+		return nil, fmt.Errorf("error fitting Fourier series to state matrices: %w", err)
+	}
+
+	// State groups which define the matrix blocks
+	groups := []struct {
+		name       string
+		start, end int
+	}{
+		{"Displacement", 0, md.NumDOF2},
+		{"Velocity", md.NumDOF2, md.NumStates2},
+		{"First Order", md.NumStates2, md.NumStates},
+	}
+
+	avgNorm := mat.Norm(fm.Mean, 2)
+
+	for _, rg := range groups {
+		for _, cg := range groups {
+			if rg.start == rg.end || cg.start == cg.end {
+				continue
+			}
+
+			block := PeriodicityBlock{
+				Name:      rg.name + "/" + cg.name,
+				Rows:      [2]int{rg.start, rg.end},
+				Cols:      [2]int{cg.start, cg.end},
+				Mean:      mat.Norm(fm.Mean.Slice(rg.start, rg.end, cg.start, cg.end), 2),
+				Harmonics: make([]float64, numHarmonics),
+			}
+
+			ref := block.Mean
+			if ref <= periodicityZeroTol*avgNorm {
+				ref = avgNorm
+			}
+
+			for k := range block.Harmonics {
+				c := mat.Norm(fm.Cos[k].Slice(rg.start, rg.end, cg.start, cg.end), 2)
+				s := mat.Norm(fm.Sin[k].Slice(rg.start, rg.end, cg.start, cg.end), 2)
+				if ref > 0 {
+					block.Harmonics[k] = math.Hypot(c, s) / ref
+				}
+				if block.Harmonics[k] > pr.MaxRatio {
+					pr.MaxRatio = block.Harmonics[k]
+				}
+				if block.Harmonics[k] > threshold {
+					block.Flagged = true
+					pr.Flagged = true
+				}
+			}
+
+			pr.Blocks = append(pr.Blocks, block)
+		}
+	}
+
+	return pr, nil
+}
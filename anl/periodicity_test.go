@@ -0,0 +1,110 @@
+package anl_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+func TestResidualPeriodicity(t *testing.T) {
+
+	// System constant in the fixed frame has no residual periodicity
+	azimuths := make([]float64, 8)
+	for i := range azimuths {
+		azimuths[i] = 2 * math.Pi * float64(i) / float64(len(azimuths))
+	}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr, err := anl.ResidualPeriodicity(md, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Threshold != anl.DefaultPeriodicityThreshold {
+		t.Fatalf("Threshold = %v, expected default", pr.Threshold)
+	}
+	if pr.Flagged || pr.MaxRatio > 1e-10 {
+		t.Fatalf("constant system flagged, MaxRatio = %v", pr.MaxRatio)
+	}
+	if len(pr.Blocks) != 4 {
+		t.Fatalf("got %d blocks, expected 4", len(pr.Blocks))
+	}
+	for _, b := range pr.Blocks {
+		if len(b.Harmonics) != 3 {
+			t.Fatalf("block %s: got %d harmonics, expected 3", b.Name, len(b.Harmonics))
+		}
+	}
+
+	// First order state with 1P content of half the mean
+	linData := make([]*anl.LinData, 8)
+	for i := range linData {
+		psi := azimuths[i]
+		linData[i] = &anl.LinData{
+			Azimuth:    psi,
+			RotorSpeed: 0.8,
+			NumX:       1,
+			X: []anl.OperPointData{
+				{RC: 1, DerivOrder: 1, Desc: "BD_1 First order state, -"},
+			},
+			A: mat.NewDense(1, 1, []float64{-1 + 0.5*math.Cos(psi)}),
+		}
+		linData[i].Xd = linData[i].X
+	}
+	if md, err = anl.CollectMatrixData(linData, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if pr, err = anl.ResidualPeriodicity(md, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.Blocks) != 1 || pr.Blocks[0].Name != "First Order/First Order" {
+		t.Fatalf("unexpected blocks %+v", pr.Blocks)
+	}
+	b := pr.Blocks[0]
+	for k, exp := range []float64{0.5, 0, 0} {
+		if math.Abs(b.Harmonics[k]-exp) > 1e-12 {
+			t.Errorf("harmonic %dP = %v, expected %v", k+1, b.Harmonics[k], exp)
+		}
+	}
+	if !pr.Flagged || !b.Flagged {
+		t.Fatal("expected periodic system to be flagged")
+	}
+	if pr, err = anl.ResidualPeriodicity(md, 0.6); err != nil {
+		t.Fatal(err)
+	} else if pr.Flagged {
+		t.Fatal("expected periodic system below threshold not to be flagged")
+	}
+
+	// Only harmonics resolved by the azimuth samples are reported, and the
+	// harmonic content is unbiased for azimuths covering half a revolution
+	if md, err = anl.CollectMatrixData(linData[:4:4], 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pr, err = anl.ResidualPeriodicity(md, 0); err != nil {
+		t.Fatal(err)
+	}
+	if len(pr.Blocks[0].Harmonics) != 1 {
+		t.Fatalf("got %d harmonics with 4 azimuths, expected 1", len(pr.Blocks[0].Harmonics))
+	}
+	if h := pr.Blocks[0].Harmonics[0]; math.Abs(h-0.5) > 1e-12 {
+		t.Errorf("harmonic 1P with 4 azimuths = %v, expected 0.5", h)
+	}
+
+	// Unevenly spaced azimuths
+	uneven := []*anl.LinData{linData[0], linData[1], linData[3], linData[4], linData[7]}
+	if md, err = anl.CollectMatrixData(uneven, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if pr, err = anl.ResidualPeriodicity(md, 0); err != nil {
+		t.Fatal(err)
+	}
+	for k, exp := range []float64{0.5, 0} {
+		if h := pr.Blocks[0].Harmonics[k]; math.Abs(h-exp) > 1e-12 {
+			t.Errorf("harmonic %dP with uneven azimuths = %v, expected %v", k+1, h, exp)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+package anl
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sort"
+
+	"gonum.org/v1/gonum/mat"
+)
+
+// Model reduction methods
+const (
+	ReductionBalanced = "balanced" // Balanced truncation
+	ReductionModal    = "modal"    // Modal truncation by frequency band
+)
+
+// Maximum number of squared Smith iterations used to solve for the gramians
+const maxGramianIterations = 100
+
+// ReducedModel is a reduced order state-space model of the azimuth averaged
+// MBC state-space model. States of the reduced model are not physical, so
+// only the input and output descriptions are retained. Modes which are
+// unstable or marginally stable (including rigid-body modes) are always
+// retained exactly and are the first NumUnstable states.
+type ReducedModel struct {
+	Method               string
+	NumStates            int
+	NumUnstable          int
+	A, B, C, D           *mat.Dense
+	DescInputs           []OperPointData
+	DescOutputs          []OperPointData
+	HankelSingularValues []float64 // Stable part, descending (balanced truncation only)
+	ErrorBound           float64   // Bound on the H-infinity norm of the error
+}
+
+// BalancedTruncation reduces the azimuth averaged MBC state-space model to
+// the given number of states by balanced truncation of its stable part. The
+// error bound is twice the sum of the discarded Hankel singular values.
+func (md *MatData) BalancedTruncation(order int) (*ReducedModel, error) {
+
+	if order < 1 {
+		return nil, fmt.Errorf("order %d must be at least 1", order)
+	}
+
+	mf, err := newModalForm(md)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split modes into unstable and stable parts
+	unstable, stable := []int{}, []int{}
+	for i, ev := range mf.values {
+		if real(ev) >= -rigidBodyTol {
+			unstable = append(unstable, i)
+		} else {
+			stable = append(stable, i)
+		}
+	}
+	Au, Bu, Cu := mf.subsystem(md, unstable)
+	numUnstable := mf.numStates(unstable)
+	if order < numUnstable {
+		return nil, fmt.Errorf("order %d less than number of unstable states %d", order, numUnstable)
+	}
+	if order > md.NumStates {
+		return nil, fmt.Errorf("order %d greater than number of states %d", order, md.NumStates)
+	}
+
+	rm := &ReducedModel{
+		Method:      ReductionBalanced,
+		NumStates:   order,
+		NumUnstable: numUnstable,
+		D:           md.AvgD,
+		DescInputs:  md.DescInputs,
+		DescOutputs: md.DescOutputs,
+	}
+
+	// Balanced truncation of stable part
+	As, Bs, Cs := mf.subsystem(md, stable)
+	var Ar, Br, Cr *mat.Dense
+	if As != nil {
+		if Ar, Br, Cr, rm.HankelSingularValues, err = balancedTruncation(As, Bs, Cs, order-numUnstable); err != nil {
+			return nil, err
+		}
+		for _, hsv := range rm.HankelSingularValues[order-numUnstable:] {
+			rm.ErrorBound += 2 * hsv
+		}
+	}
+
+	rm.A, rm.B, rm.C = joinSubsystems(Au, Bu, Cu, Ar, Br, Cr)
+	if rm.A == nil {
+		return nil, fmt.Errorf("no states retained for order %d", order)
+	}
+	if rm.NumStates, _ = rm.A.Dims(); rm.NumStates != order {
+		return nil, fmt.Errorf("reduced model has %d states, expected order %d", rm.NumStates, order)
+	}
+	return rm, nil
+}
+
+// ModalTruncation reduces the azimuth averaged MBC state-space model to the
+// modes with natural frequencies between minHz and maxHz inclusive, along
+// with all unstable and marginally stable modes. The error bound is the sum
+// over the discarded modes of |C_i|*|B_i|/|Re(ev_i)|.
+func (md *MatData) ModalTruncation(minHz, maxHz float64) (*ReducedModel, error) {
+
+	if maxHz < minHz {
+		return nil, fmt.Errorf("invalid frequency band [%v, %v]", minHz, maxHz)
+	}
+
+	mf, err := newModalForm(md)
+	if err != nil {
+		return nil, err
+	}
+
+	rm := &ReducedModel{
+		Method:      ReductionModal,
+		D:           md.AvgD,
+		DescInputs:  md.DescInputs,
+		DescOutputs: md.DescOutputs,
+	}
+
+	// Select modes, with unstable modes first
+	unstable, inBand := []int{}, []int{}
+	for i, ev := range mf.values {
+		freqHz := math.Hypot(real(ev), imag(ev)) / (2 * math.Pi)
+		switch {
+		case real(ev) >= -rigidBodyTol:
+			unstable = append(unstable, i)
+		case freqHz >= minHz && freqHz <= maxHz:
+			inBand = append(inBand, i)
+		default:
+			// Bound on error from discarding mode
+			_, Bi, Ci := mf.subsystem(md, []int{i})
+			rm.ErrorBound += mat.Norm(Ci, 2) * mat.Norm(Bi, 2) / math.Abs(real(ev))
+		}
+	}
+
+	if len(unstable)+len(inBand) == 0 {
+		return nil, fmt.Errorf("no unstable modes or modes in frequency band [%v, %v]", minHz, maxHz)
+	}
+
+	rm.NumUnstable = mf.numStates(unstable)
+	rm.A, rm.B, rm.C = mf.subsystem(md, append(unstable, inBand...))
+	rm.NumStates, _ = rm.A.Dims()
+	return rm, nil
+}
+
+// FrequencyResponse computes the frequency response of the reduced model
+// from the named input to the named output at the given frequencies (Hz).
+func (rm *ReducedModel) FrequencyResponse(input, output string, freqHz []float64) (*FreqResponse, error) {
+	var D mat.Matrix
+	if rm.D != nil {
+		D = rm.D
+	}
+	return frequencyResponse(rm.A, rm.B, rm.C, D,
+		descriptions(rm.DescInputs), descriptions(rm.DescOutputs), input, output, freqHz)
+}
+
+// modalForm is the real modal decomposition of the averaged state matrix.
+// Each mode has one column in the transformation for a real eigenvalue or
+// two columns (real and imaginary parts of the eigenvector) for a complex
+// conjugate pair, which makes the transformed state matrix block diagonal.
+type modalForm struct {
+	values  []complex128 // Eigenvalue of each mode with imag >= 0
+	columns [][]int      // Transformation columns of each mode
+	T, Tinv *mat.Dense   // Transformation from modal to physical states
+}
+
+func newModalForm(md *MatData) (*modalForm, error) {
+
+	if md.AvgB == nil || md.AvgC == nil {
+		return nil, fmt.Errorf("model reduction requires input and output matrices")
+	}
+
+	eig := mat.Eigen{}
+	if ok := eig.Factorize(md.AvgA, mat.EigenRight); !ok {
+		return nil, fmt.Errorf("error computing eigenvalues")
+	}
+	eigvecs := &mat.CDense{}
+	eig.VectorsTo(eigvecs)
+
+	n := md.NumStates
+	mf := &modalForm{T: mat.NewDense(n, n, nil)}
+	col := 0
+	for i, ev := range eig.Values(nil) {
+		switch {
+		case imag(ev) == 0:
+			for r := 0; r < n; r++ {
+				mf.T.Set(r, col, real(eigvecs.At(r, i)))
+			}
+			mf.columns = append(mf.columns, []int{col})
+			col++
+		case imag(ev) > 0:
+			for r := 0; r < n; r++ {
+				mf.T.Set(r, col, real(eigvecs.At(r, i)))
+				mf.T.Set(r, col+1, imag(eigvecs.At(r, i)))
+			}
+			mf.columns = append(mf.columns, []int{col, col + 1})
+			col += 2
+		default:
+			continue
+		}
+		mf.values = append(mf.values, ev)
+	}
+
+	mf.Tinv = &mat.Dense{}
+	if err := mf.Tinv.Inverse(mf.T); err != nil {
+		return nil, fmt.Errorf("state matrix is defective, eigenvectors are not independent: %w", err)
+	}
+
+	// Order modes by natural frequency
+	idx := make([]int, len(mf.values))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool {
+		return cmplx.Abs(mf.values[idx[i]]) < cmplx.Abs(mf.values[idx[j]])
+	})
+	values, columns := make([]complex128, len(idx)), make([][]int, len(idx))
+	for i, j := range idx {
+		values[i], columns[i] = mf.values[j], mf.columns[j]
+	}
+	mf.values, mf.columns = values, columns
+
+	return mf, nil
+}
+
+// numStates returns the number of states of the modes.
+func (mf *modalForm) numStates(modes []int) int {
+	n := 0
+	for _, m := range modes {
+		n += len(mf.columns[m])
+	}
+	return n
+}
+
+// subsystem returns the state-space matrices of the modes in modal
+// coordinates, or nil if there are no modes.
+func (mf *modalForm) subsystem(md *MatData, modes []int) (A, B, C *mat.Dense) {
+	cols := []int{}
+	for _, m := range modes {
+		cols = append(cols, mf.columns[m]...)
+	}
+	if len(cols) == 0 {
+		return nil, nil, nil
+	}
+	T := mat.NewDense(md.NumStates, len(cols), nil)
+	Tinv := mat.NewDense(len(cols), md.NumStates, nil)
+	for j, c := range cols {
+		T.SetCol(j, mat.Col(nil, c, mf.T))
+		Tinv.SetRow(j, mat.Row(nil, c, mf.Tinv))
+	}
+	A, B, C = &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+	A.Product(Tinv, md.AvgA, T)
+	B.Mul(Tinv, md.AvgB)
+	C.Mul(md.AvgC, T)
+	return A, B, C
+}
+
+// balancedTruncation reduces the stable system to the given order with the
+// square root balanced truncation method and returns the Hankel singular
+// values in descending order.
+func balancedTruncation(A, B, C *mat.Dense, order int) (Ar, Br, Cr *mat.Dense, hsv []float64, err error) {
+
+	// Controllability and observability gramians
+	P, err := gramian(A, B, false)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error computing controllability gramian: %w", err)
+	}
+	Q, err := gramian(A, C, true)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("error computing observability gramian: %w", err)
+	}
+
+	// Square root factors, P = Lc*Lc^T and Q = Lo*Lo^T
+	Lc, Lo := sqrtFactor(P), sqrtFactor(Q)
+
+	// Hankel singular values from SVD of Lo^T*Lc = U*S*V^T
+	M := &mat.Dense{}
+	M.Mul(Lo.T(), Lc)
+	svd := mat.SVD{}
+	if ok := svd.Factorize(M, mat.SVDThin); !ok {
+		return nil, nil, nil, nil, fmt.Errorf("error computing Hankel singular values")
+	}
+	hsv = svd.Values(nil)
+	if order == 0 {
+		return nil, nil, nil, hsv, nil
+	}
+	if hsv[order-1] <= hsv[0]*1e-14 || hsv[order-1] == 0 {
+		return nil, nil, nil, nil, fmt.Errorf("order %d exceeds the number of controllable and observable states", order)
+	}
+
+	U, V := &mat.Dense{}, &mat.Dense{}
+	svd.UTo(U)
+	svd.VTo(V)
+
+	// Balancing transformation T = Lc*V_r*S_r^-1/2, Tinv = S_r^-1/2*U_r^T*Lo^T
+	n, _ := A.Dims()
+	T := mat.NewDense(n, order, nil)
+	Tinv := mat.NewDense(order, n, nil)
+	T.Mul(Lc, V.Slice(0, n, 0, order))
+	Tinv.Mul(U.Slice(0, n, 0, order).T(), Lo.T())
+	for j := 0; j < order; j++ {
+		s := 1 / math.Sqrt(hsv[j])
+		for i := 0; i < n; i++ {
+			T.Set(i, j, T.At(i, j)*s)
+			Tinv.Set(j, i, Tinv.At(j, i)*s)
+		}
+	}
+
+	Ar, Br, Cr = &mat.Dense{}, &mat.Dense{}, &mat.Dense{}
+	Ar.Product(Tinv, A, T)
+	Br.Mul(Tinv, B)
+	Cr.Mul(C, T)
+
+	return Ar, Br, Cr, hsv, nil
+}
+
+// gramian solves the Lyapunov equation A*P + P*A^T + B*B^T = 0 for the
+// controllability gramian, or A^T*Q + Q*A + C^T*C = 0 for the observability
+// gramian if dual is true. The equation is converted to a Stein equation with
+// a Cayley transform and solved by squared Smith iteration.
+func gramian(A, B *mat.Dense, dual bool) (*mat.Dense, error) {
+
+	n, _ := A.Dims()
+	At, Bt := mat.DenseCopyOf(A), mat.DenseCopyOf(B)
+	if dual {
+		At = mat.DenseCopyOf(A.T())
+		Bt = mat.DenseCopyOf(B.T())
+	}
+
+	// Cayley shift from the geometric mean of the eigenvalue magnitudes
+	eig := mat.Eigen{}
+	if ok := eig.Factorize(At, mat.EigenNone); !ok {
+		return nil, fmt.Errorf("error computing eigenvalues")
+	}
+	minAbs, maxAbs := math.Inf(1), 0.0
+	for _, ev := range eig.Values(nil) {
+		abs := math.Hypot(real(ev), imag(ev))
+		minAbs, maxAbs = math.Min(minAbs, abs), math.Max(maxAbs, abs)
+	}
+	p := math.Sqrt(minAbs * maxAbs)
+
+	// Ad = (A - pI)^-1*(A + pI), Bd = sqrt(2p)*(A - pI)^-1*B
+	Am, Ap := mat.DenseCopyOf(At), mat.DenseCopyOf(At)
+	for i := 0; i < n; i++ {
+		Am.Set(i, i, Am.At(i, i)-p)
+		Ap.Set(i, i, Ap.At(i, i)+p)
+	}
+	Ad, Bd := &mat.Dense{}, &mat.Dense{}
+	if err := Ad.Solve(Am, Ap); err != nil {
+		return nil, err
+	}
+	if err := Bd.Solve(Am, Bt); err != nil {
+		return nil, err
+	}
+	Bd.Scale(math.Sqrt(2*p), Bd)
+
+	// Squared Smith iteration, P = sum Ad^k*Bd*Bd^T*Ad^k^T
+	P := &mat.Dense{}
+	P.Mul(Bd, Bd.T())
+	tmp, Ad2 := &mat.Dense{}, &mat.Dense{}
+	for k := 0; k < maxGramianIterations; k++ {
+		tmp.Product(Ad, P, Ad.T())
+		P.Add(P, tmp)
+		if mat.Norm(tmp, 1) <= 1e-15*mat.Norm(P, 1) {
+			return P, nil
+		}
+		Ad2.Mul(Ad, Ad)
+		Ad, Ad2 = Ad2, Ad
+	}
+
+	return nil, fmt.Errorf("squared Smith iteration did not converge")
+}
+
+// sqrtFactor returns L such that S = L*L^T for the symmetric positive
+// semi-definite matrix S. Negative eigenvalues from round-off are set to zero.
+func sqrtFactor(S *mat.Dense) *mat.Dense {
+	n, _ := S.Dims()
+	sym := mat.NewSymDense(n, nil)
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			sym.SetSym(i, j, 0.5*(S.At(i, j)+S.At(j, i)))
+		}
+	}
+	es := mat.EigenSym{}
+	es.Factorize(sym, true)
+	L := &mat.Dense{}
+	es.VectorsTo(L)
+	for j, v := range es.Values(nil) {
+		s := math.Sqrt(math.Max(v, 0))
+		for i := 0; i < n; i++ {
+			L.Set(i, j, L.At(i, j)*s)
+		}
+	}
+	return L
+}
+
+// joinSubsystems returns the state-space matrices of the parallel connection
+// of two subsystems, either of which may be nil.
+func joinSubsystems(A1, B1, C1, A2, B2, C2 *mat.Dense) (A, B, C *mat.Dense) {
+	switch {
+	case A1 == nil:
+		return A2, B2, C2
+	case A2 == nil:
+		return A1, B1, C1
+	}
+	n1, _ := A1.Dims()
+	n2, _ := A2.Dims()
+	_, m := B1.Dims()
+	p, _ := C1.Dims()
+	A = mat.NewDense(n1+n2, n1+n2, nil)
+	B = mat.NewDense(n1+n2, m, nil)
+	C = mat.NewDense(p, n1+n2, nil)
+	A.Slice(0, n1, 0, n1).(*mat.Dense).Copy(A1)
+	A.Slice(n1, n1+n2, n1, n1+n2).(*mat.Dense).Copy(A2)
+	B.Slice(0, n1, 0, m).(*mat.Dense).Copy(B1)
+	B.Slice(n1, n1+n2, 0, m).(*mat.Dense).Copy(B2)
+	C.Slice(0, p, 0, n1).(*mat.Dense).Copy(C1)
+	C.Slice(0, p, n1, n1+n2).(*mat.Dense).Copy(C2)
+	return A, B, C
+}
@@ -0,0 +1,196 @@
+package anl_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+// modeStates returns the number of states of the modes which are unstable if
+// unstable is true, or otherwise in the frequency band.
+func modeStates(md *anl.MatData, unstable bool, minHz, maxHz float64) int {
+	n := 0
+	for _, mode := range md.Modes {
+		isUnstable := real(mode.EigenValue) >= 0
+		inBand := mode.NaturalFreqHz >= minHz && mode.NaturalFreqHz <= maxHz
+		if unstable && isUnstable || !unstable && !isUnstable && inBand {
+			n++
+			if imag(mode.EigenValue) != 0 {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// maxResponseError returns the maximum magnitude error between the reduced
+// and full model responses over all input and output pairs.
+func maxResponseError(t *testing.T, md *anl.MatData, rm *anl.ReducedModel, freqHz []float64) float64 {
+	t.Helper()
+	maxErr := 0.0
+	for _, in := range md.DescInputs {
+		for _, out := range md.DescOutputs {
+			full, err := md.FrequencyResponse(in.Desc, out.Desc, freqHz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			red, err := rm.FrequencyResponse(in.Desc, out.Desc, freqHz)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k := range freqHz {
+				// Magnitude difference is a lower bound on the complex error
+				maxErr = math.Max(maxErr, math.Abs(full.Magnitude[k]-red.Magnitude[k]))
+			}
+		}
+	}
+	return maxErr
+}
+
+func TestBalancedTruncation(t *testing.T) {
+
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freqHz, _ := anl.LogFrequencies(0.01, 10, 60)
+
+	// Full order model reproduces the response, the unstable mode of the
+	// test system is retained exactly
+	numUnstable := modeStates(md, true, 0, 0)
+	rm, err := md.BalancedTruncation(md.NumStates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.NumUnstable != numUnstable || rm.ErrorBound != 0 {
+		t.Fatalf("NumUnstable = %d, ErrorBound = %v, expected %d, 0", rm.NumUnstable, rm.ErrorBound, numUnstable)
+	}
+	if len(rm.HankelSingularValues) != md.NumStates-numUnstable {
+		t.Fatalf("got %d Hankel singular values, expected %d", len(rm.HankelSingularValues), md.NumStates-numUnstable)
+	}
+	for i := 1; i < len(rm.HankelSingularValues); i++ {
+		if rm.HankelSingularValues[i] > rm.HankelSingularValues[i-1] {
+			t.Fatalf("Hankel singular values not descending: %v", rm.HankelSingularValues)
+		}
+	}
+	if e := maxResponseError(t, md, rm, freqHz); e > 1e-8 {
+		t.Fatalf("full order response error = %v", e)
+	}
+
+	// Reduced order models are within the error bound
+	for order := numUnstable + 1; order < md.NumStates; order++ {
+		rm, err := md.BalancedTruncation(order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, c := rm.A.Dims(); r != order || c != order {
+			t.Fatalf("reduced A is %dx%d, expected %dx%d", r, c, order, order)
+		}
+		if e := maxResponseError(t, md, rm, freqHz); e > rm.ErrorBound*(1+1e-8) {
+			t.Errorf("order %d: response error %v exceeds bound %v", order, e, rm.ErrorBound)
+		}
+	}
+
+	if _, err := md.BalancedTruncation(md.NumStates + 1); err == nil {
+		t.Fatal("expected error for order greater than number of states")
+	}
+	if numUnstable > 1 {
+		if _, err := md.BalancedTruncation(numUnstable - 1); err == nil || !strings.Contains(err.Error(), "unstable") {
+			t.Fatalf("BalancedTruncation(%d) error = %v, expected error for order less than number of unstable states", numUnstable-1, err)
+		}
+	}
+}
+
+func TestBalancedTruncationRigidBody(t *testing.T) {
+
+	// Rotor azimuth is a rigid-body mode which must be retained
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := md.BalancedTruncation(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.NumUnstable != 1 || rm.NumStates != 1 {
+		t.Fatalf("NumUnstable = %d, NumStates = %d, expected 1", rm.NumUnstable, rm.NumStates)
+	}
+	if _, err := md.BalancedTruncation(0); err == nil || !strings.Contains(err.Error(), "at least 1") {
+		t.Fatalf("BalancedTruncation(0) error = %v, expected error for order less than 1", err)
+	}
+}
+
+func TestModalTruncation(t *testing.T) {
+
+	azimuths := []float64{0, math.Pi / 2, math.Pi, 3 * math.Pi / 2}
+	ts := newTestSystem(3, 1.2, azimuths)
+	md, err := anl.CollectMatrixData(ts.LinData, 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freqHz, _ := anl.LogFrequencies(0.01, 10, 60)
+
+	// All modes retained
+	rm, err := md.ModalTruncation(0, math.Inf(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rm.NumStates != md.NumStates || rm.ErrorBound != 0 {
+		t.Fatalf("NumStates = %d, ErrorBound = %v", rm.NumStates, rm.ErrorBound)
+	}
+	if e := maxResponseError(t, md, rm, freqHz); e > 1e-8 {
+		t.Fatalf("full order response error = %v", e)
+	}
+
+	// Only modes in band retained
+	minHz, maxHz := md.Modes[1].NaturalFreqHz*0.999, md.Modes[2].NaturalFreqHz*1.001
+	rm, err = md.ModalTruncation(minHz, maxHz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expStates := modeStates(md, true, 0, 0) + modeStates(md, false, minHz, maxHz)
+	if rm.NumStates != expStates || expStates == md.NumStates {
+		t.Fatalf("NumStates = %d, expected %d", rm.NumStates, expStates)
+	}
+	if e := maxResponseError(t, md, rm, freqHz); e > rm.ErrorBound*(1+1e-8) {
+		t.Errorf("response error %v exceeds bound %v", e, rm.ErrorBound)
+	}
+
+	if _, err := md.ModalTruncation(2, 1); err == nil {
+		t.Fatal("expected error for invalid band")
+	}
+}
+
+func TestReducedModelWithoutStableModes(t *testing.T) {
+
+	// Drivetrain with negative damping has no stable modes, so the reduced
+	// model contains only the unstable part
+	md, err := anl.CollectMatrixData(newDrivetrainLinData(-0.1, -0.2, -0.01), 3, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := md.BalancedTruncation(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := rm.A.Dims(); rm.NumStates != 2 || r != 2 {
+		t.Fatalf("NumStates = %d, A has %d rows, expected 2", rm.NumStates, r)
+	}
+
+	// Stable model without modes in the band
+	linData := newDrivetrainLinData(0.1, -0.2, -0.01)
+	for _, ld := range linData {
+		ld.A = mat.NewDense(2, 2, []float64{-1, 0, 0, -2})
+	}
+	if md, err = anl.CollectMatrixData(linData, 3, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := md.ModalTruncation(1000, 2000); err == nil {
+		t.Fatal("expected error for band without modes")
+	}
+}
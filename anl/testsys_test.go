@@ -0,0 +1,252 @@
+package anl_test
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
+)
+
+// testSystem is a fixed frame state-space model of a rotor with one tower
+// DOF and one flap DOF per blade, along with the rotating frame
+// linearization data which produces it.
+type testSystem struct {
+	A, B, C, D *mat.Dense
+	OpX, OpXd  *mat.VecDense
+	LinData    []*anl.LinData
+}
+
+// newTestSystem creates a fixed frame model in MBC ordering (tower, then
+// blade collective, cosine, sine, differential) and transforms it into the
+// rotating frame at the given azimuths (rad) with constant rotor speed omega
+// (rad/s). The rotating frame data is written in OpenFAST ordering with the
+// blade states before the tower state so the MBC permutations are exercised.
+func newTestSystem(numBlades int, omega float64, azimuths []float64) *testSystem {
+
+	nq := numBlades + 1
+
+	// Fixed frame stiffness and damping (already mass normalized), with
+	// coupling between the cosine and sine coordinates
+	K := mat.NewDense(nq, nq, nil)
+	Cd := mat.NewDense(nq, nq, nil)
+	for i := 0; i < nq; i++ {
+		for j := 0; j < nq; j++ {
+			K.Set(i, j, 0.1*float64((i+2*j)%3))
+			Cd.Set(i, j, 0.01*float64((2*i+j)%3))
+		}
+		K.Set(i, i, -4-2*float64(i))
+		Cd.Set(i, i, -0.1-0.05*float64(i))
+	}
+	if numBlades >= 3 {
+		K.Set(2, 3, 1.5)
+		K.Set(3, 2, -1.2)
+		Cd.Set(2, 3, 0.3)
+		Cd.Set(3, 2, -0.3)
+	}
+
+	ts := &testSystem{
+		A: mat.NewDense(2*nq, 2*nq, nil),
+		B: mat.NewDense(2*nq, nq, nil),
+		C: mat.NewDense(nq, 2*nq, nil),
+		D: mat.NewDense(nq, nq, nil),
+	}
+	ts.A.Slice(0, nq, nq, 2*nq).(*mat.Dense).Copy(eye(nq))
+	ts.A.Slice(nq, 2*nq, 0, nq).(*mat.Dense).Copy(K)
+	ts.A.Slice(nq, 2*nq, nq, 2*nq).(*mat.Dense).Copy(Cd)
+	for i := 0; i < nq; i++ {
+		for j := 0; j < nq; j++ {
+			ts.B.Set(nq+i, j, 0.1*float64(i+1)-0.05*float64(j))
+			ts.C.Set(i, j, 1.0+0.1*float64(i*j))
+			ts.C.Set(i, nq+j, 0.01*float64(i+j))
+			ts.D.Set(i, j, 0.02*float64(i-j))
+		}
+	}
+
+	// Fixed frame operating point and its time derivative
+	ts.OpX = mat.NewVecDense(2*nq, nil)
+	for i := 0; i < 2*nq; i++ {
+		ts.OpX.SetVec(i, 0.1*float64(i+1))
+	}
+	ts.OpXd = mat.NewVecDense(2*nq, nil)
+	ts.OpXd.MulVec(ts.A, ts.OpX)
+
+	// Permutation from MBC ordering (tower first) to file ordering (tower last),
+	// row i of P*M is row perm[i] of M
+	permQ := make([]int, nq)
+	permX := make([]int, 2*nq)
+	for i := 0; i < nq; i++ {
+		permQ[i] = (i + 1) % nq
+		permX[i] = permQ[i]
+		permX[nq+i] = permQ[i] + nq
+	}
+	Pq, Px := &mat.Dense{}, &mat.Dense{}
+	Pq.Permutation(nq, permQ)
+	Px.Permutation(2*nq, permX)
+
+	for _, az := range azimuths {
+
+		// Blade transformation and derivatives with respect to azimuth
+		tt, tt2, tt3 := testBladeTransforms(numBlades, az)
+		T1 := blkDiag(eye(1), tt)
+		T2 := blkDiag(mat.NewDense(1, 1, nil), tt2)
+		T3 := blkDiag(mat.NewDense(1, 1, nil), tt3)
+
+		// x_rot = L*x_nr and its time derivative
+		L := blkDiag(T1, T1)
+		L.Slice(nq, 2*nq, 0, nq).(*mat.Dense).Scale(omega, T2)
+		Ld := blkDiag(T2, T2)
+		Ld.Scale(omega, Ld)
+		Ld.Slice(nq, 2*nq, 0, nq).(*mat.Dense).Scale(omega*omega, T3)
+
+		Lv, T1v := &mat.Dense{}, &mat.Dense{}
+		Lv.Inverse(L)
+		T1v.Inverse(T1)
+
+		// A_rot = (Ld + L*A_nr)*L^-1
+		AR := &mat.Dense{}
+		AR.Mul(L, ts.A)
+		AR.Add(AR, Ld)
+		AR.Mul(AR, Lv)
+
+		// B_rot = L*B_nr*T1^-1
+		BR := &mat.Dense{}
+		BR.Mul(L, ts.B)
+		BR.Mul(BR, T1v)
+
+		// C_rot = T1*C_nr*L^-1
+		CR := &mat.Dense{}
+		CR.Mul(T1, ts.C)
+		CR.Mul(CR, Lv)
+
+		// D_rot = T1*D_nr*T1^-1
+		DR := &mat.Dense{}
+		DR.Mul(T1, ts.D)
+		DR.Mul(DR, T1v)
+
+		// x_rot = L*x_nr, xd_rot = Ld*x_nr + L*xd_nr
+		opx, opxd := mat.NewVecDense(2*nq, nil), mat.NewVecDense(2*nq, nil)
+		opx.MulVec(L, ts.OpX)
+		opxd.MulVec(L, ts.OpXd)
+		tmp := mat.NewVecDense(2*nq, nil)
+		tmp.MulVec(Ld, ts.OpX)
+		opxd.AddVec(opxd, tmp)
+
+		// Reorder into file ordering
+		opx.MulVec(Px, opx)
+		opxd.MulVec(Px, opxd)
+		AR.Mul(Px, AR)
+		AR.Mul(AR, Px.T())
+		BR.Mul(Px, BR)
+		BR.Mul(BR, Pq.T())
+		CR.Mul(Pq, CR)
+		CR.Mul(CR, Px.T())
+		DR.Mul(Pq, DR)
+		DR.Mul(DR, Pq.T())
+
+		ld := &anl.LinData{
+			RotorSpeed: omega,
+			Azimuth:    az,
+			WindSpeed:  10,
+			NumX:       2 * nq,
+			NumX2:      2 * nq,
+			NumU:       nq,
+			NumY:       nq,
+			A:          AR,
+			B:          BR,
+			C:          CR,
+			D:          DR,
+		}
+		for i := 1; i <= numBlades; i++ {
+			ld.X = append(ld.X, anl.OperPointData{RC: i, IsRotating: true, DerivOrder: 2,
+				Desc: fmt.Sprintf("ED 1st flapwise bending-mode DOF of blade %d (internal DOF index = DOF_BF(%d,1)), m", i, i)})
+			ld.U = append(ld.U, anl.OperPointData{RC: i, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d pitch command, rad", i)})
+			ld.Y = append(ld.Y, anl.OperPointData{RC: i, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d root out-of-plane moment, kN-m", i)})
+		}
+		ld.X = append(ld.X, anl.OperPointData{RC: nq, DerivOrder: 2,
+			Desc: "ED 1st tower fore-aft bending mode DOF (internal DOF index = DOF_TFA1), m"})
+		ld.U = append(ld.U, anl.OperPointData{RC: nq,
+			Desc: "IfW Extended input: horizontal wind speed (steady/uniform wind), m/s"})
+		ld.Y = append(ld.Y, anl.OperPointData{RC: nq,
+			Desc: "ED TwrBsMyt, (kN-m)"})
+		for i := 0; i < nq; i++ {
+			op := ld.X[i]
+			op.RC += nq
+			module, rest, _ := strings.Cut(op.Desc, " ")
+			op.Desc = module + " First time derivative of " + rest + "/s"
+			ld.X = append(ld.X, op)
+		}
+		ld.Xd = make([]anl.OperPointData, len(ld.X))
+		for i := range ld.X {
+			ld.X[i].OperPoint = opx.AtVec(i)
+			ld.Xd[i] = ld.X[i]
+			ld.Xd[i].OperPoint = opxd.AtVec(i)
+		}
+
+		ts.LinData = append(ts.LinData, ld)
+	}
+
+	return ts
+}
+
+// testBladeTransforms returns the blade transformation matrix (eq. 9) and its
+// first and second derivatives with respect to azimuth (eq. 16).
+func testBladeTransforms(numBlades int, az float64) (tt, tt2, tt3 *mat.Dense) {
+	tt = mat.NewDense(numBlades, numBlades, nil)
+	tt2 = mat.NewDense(numBlades, numBlades, nil)
+	tt3 = mat.NewDense(numBlades, numBlades, nil)
+	for i := 0; i < numBlades; i++ {
+		psi := az + 2*math.Pi*float64(i)/float64(numBlades)
+		tt.Set(i, 0, 1)
+		for k := 1; k <= (numBlades-1)/2; k++ {
+			fk := float64(k)
+			s, c := math.Sincos(fk * psi)
+			tt.Set(i, 2*k-1, c)
+			tt.Set(i, 2*k, s)
+			tt2.Set(i, 2*k-1, -fk*s)
+			tt2.Set(i, 2*k, fk*c)
+			tt3.Set(i, 2*k-1, -fk*fk*c)
+			tt3.Set(i, 2*k, -fk*fk*s)
+		}
+		if numBlades%2 == 0 {
+			tt.Set(i, numBlades-1, math.Pow(-1, float64(i)))
+		}
+	}
+	return tt, tt2, tt3
+}
+
+func eye(n int) *mat.Dense {
+	m := mat.NewDense(n, n, nil)
+	for i := 0; i < n; i++ {
+		m.Set(i, i, 1)
+	}
+	return m
+}
+
+func blkDiag(ms ...*mat.Dense) *mat.Dense {
+	rows, cols := 0, 0
+	for _, m := range ms {
+		r, c := m.Dims()
+		rows, cols = rows+r, cols+c
+	}
+	out := mat.NewDense(rows, cols, nil)
+	i, j := 0, 0
+	for _, m := range ms {
+		r, c := m.Dims()
+		out.Slice(i, i+r, j, j+c).(*mat.Dense).Copy(m)
+		i, j = i+r, j+c
+	}
+	return out
+}
+
+func assertMatEqual(t *testing.T, name string, act, exp mat.Matrix, tol float64) {
+	t.Helper()
+	if !mat.EqualApprox(act, exp, tol) {
+		t.Fatalf("%s = \n%v\nexpected\n%v", name,
+			mat.Formatted(act, mat.Squeeze()), mat.Formatted(exp, mat.Squeeze()))
+	}
+}
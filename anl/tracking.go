@@ -0,0 +1,140 @@
+package anl
+
+import (
+	"math"
+	"math/cmplx"
+	"sort"
+)
+
+const (
+	// Minimum score for a mode to be matched to a mode at the previous condition
+	minTrackingScore = 0.5
+
+	// Weight of the relative frequency difference in the tracking score
+	trackingFreqWeight = 0.1
+
+	// Maximum relative frequency difference for matching modes by frequency
+	// alone when their eigenvectors can't be compared
+	trackingFreqTol = 0.05
+)
+
+// MAC returns the modal assurance criterion between two complex mode shapes,
+// which is one for identical shapes and zero for orthogonal shapes.
+func MAC(a, b []complex128) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var ab complex128
+	var aa, bb float64
+	for i := range a {
+		ab += cmplx.Conj(a[i]) * b[i]
+		aa += real(cmplx.Conj(a[i]) * a[i])
+		bb += real(cmplx.Conj(b[i]) * b[i])
+	}
+	if aa == 0 || bb == 0 {
+		return 0
+	}
+	abAbs := cmplx.Abs(ab)
+	return abAbs * abAbs / (aa * bb)
+}
+
+// trackedMode is a mode which has been matched across conditions.
+type trackedMode struct {
+	id   int
+	last *ModeResults
+}
+
+// modeMatch is a candidate match between a tracked mode and a mode at the
+// current condition.
+type modeMatch struct {
+	track, mode int
+	mac, score  float64
+}
+
+// trackModes matches modes between neighboring conditions using the MAC of
+// the eigenvectors, with frequency proximity used to break ties, and returns
+// a track ID for each mode at each condition along with the MAC between the
+// mode and the previous mode on the same track. Modes are compared to the
+// most recent mode on each track, so a track may skip conditions where the
+// mode wasn't found. Modes which can't be matched start a new track and have
+// a MAC of zero because there is no previous mode to compare with.
+func trackModes(modeSets [][]*ModeResults) (ids [][]int, macs [][]float64) {
+
+	ids = make([][]int, len(modeSets))
+	macs = make([][]float64, len(modeSets))
+	tracks := []*trackedMode{}
+
+	for k, modes := range modeSets {
+
+		ids[k] = make([]int, len(modes))
+		macs[k] = make([]float64, len(modes))
+		for i := range ids[k] {
+			ids[k][i] = -1
+		}
+
+		// Calculate scores for all combinations of tracks and modes
+		matches := []modeMatch{}
+		for i, track := range tracks {
+			for j, mode := range modes {
+				mac, score := modeMatchScore(track.last, mode)
+				if score >= minTrackingScore {
+					matches = append(matches, modeMatch{track: i, mode: j, mac: mac, score: score})
+				}
+			}
+		}
+
+		// Assign best matches first
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].score > matches[j].score
+		})
+		trackUsed := make([]bool, len(tracks))
+		for _, m := range matches {
+			if trackUsed[m.track] || ids[k][m.mode] != -1 {
+				continue
+			}
+			trackUsed[m.track] = true
+			ids[k][m.mode] = tracks[m.track].id
+			macs[k][m.mode] = m.mac
+			tracks[m.track].last = modes[m.mode]
+		}
+
+		// Start new tracks for unmatched modes in order of frequency
+		unmatched := []int{}
+		for j := range modes {
+			if ids[k][j] == -1 {
+				unmatched = append(unmatched, j)
+			}
+		}
+		sort.SliceStable(unmatched, func(i, j int) bool {
+			return modes[unmatched[i]].NaturalFreqHz < modes[unmatched[j]].NaturalFreqHz
+		})
+		for _, j := range unmatched {
+			tracks = append(tracks, &trackedMode{id: len(tracks), last: modes[j]})
+			ids[k][j] = len(tracks) - 1
+			macs[k][j] = 0
+		}
+	}
+
+	return ids, macs
+}
+
+// modeMatchScore returns the MAC between the mode eigenvectors and a score
+// for matching the modes. The score is the MAC less a penalty on the relative
+// frequency difference which breaks ties between modes with similar shapes.
+// If the eigenvectors aren't comparable, such as when the models at the two
+// conditions have different states, only the frequency difference is used and
+// modes more than trackingFreqTol apart score zero so a new track is started.
+func modeMatchScore(a, b *ModeResults) (mac, score float64) {
+	relFreqDiff := 0.0
+	if maxFreq := math.Max(a.NaturalFreqHz, b.NaturalFreqHz); maxFreq > 0 {
+		relFreqDiff = math.Abs(a.NaturalFreqHz-b.NaturalFreqHz) / maxFreq
+	}
+	if len(a.EigenVector) != len(b.EigenVector) || len(a.EigenVector) == 0 {
+		if relFreqDiff > trackingFreqTol {
+			return 0, 0
+		}
+		return 0, 1 - relFreqDiff
+	}
+	mac = MAC(a.EigenVector, b.EigenVector)
+	return mac, mac - trackingFreqWeight*relFreqDiff
+}
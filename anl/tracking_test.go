@@ -0,0 +1,111 @@
+package anl_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/deslaughter/acdc/anl"
+)
+
+func TestMAC(t *testing.T) {
+	a := []complex128{1, 2i, 0}
+	if mac := anl.MAC(a, a); math.Abs(mac-1) > 1e-12 {
+		t.Fatalf("MAC(a, a) = %v, expected 1", mac)
+	}
+	b := []complex128{-2i, 4, 0}
+	if mac := anl.MAC(a, b); math.Abs(mac-1) > 1e-12 {
+		t.Fatalf("MAC(a, b) = %v, expected 1 for scaled vector", mac)
+	}
+	c := []complex128{0, 0, 1}
+	if mac := anl.MAC(a, c); mac != 0 {
+		t.Fatalf("MAC(a, c) = %v, expected 0", mac)
+	}
+}
+
+func TestCampbellModeTracking(t *testing.T) {
+
+	// Tower mode increases in frequency and crosses the flap mode, whose
+	// frequency decreases, so sorting by frequency would swap them
+	tower := []complex128{1, 0.1, 0}
+	flap := []complex128{0.05, 0, 1}
+	edge := []complex128{0, 1, 0.1i}
+	mode := func(f float64, v []complex128) *anl.ModeResults {
+		return &anl.ModeResults{NaturalFreqHz: f, EigenVector: v}
+	}
+
+	conditions := []anl.Conditions{{ID: 1}, {ID: 2}, {ID: 3}}
+	mbcs := []*anl.MBC{
+		{Modes: []*anl.ModeResults{mode(1.0, tower), mode(1.5, flap), mode(3.0, edge)}},
+		{Modes: []*anl.ModeResults{mode(1.3, flap), mode(1.2, tower), mode(3.1, edge)}},
+		{Modes: []*anl.ModeResults{mode(3.2, edge), mode(1.1, flap), mode(1.4, tower)}},
+	}
+
+	cd, err := anl.NewCampbellData(conditions, mbcs, anl.ModeFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cd.Modes) != 3 {
+		t.Fatalf("len(Modes) = %d, expected 3", len(cd.Modes))
+	}
+
+	// Modes sorted by mean frequency: tower (1.2), flap (1.3), edge (3.1)
+	expIndexes := [][]int{{0, 1, 2}, {1, 0, 1}, {2, 2, 0}}
+	expFreqs := [][]float64{{1.0, 1.2, 1.4}, {1.5, 1.3, 1.1}, {3.0, 3.1, 3.2}}
+	for i, m := range cd.Modes {
+		if len(m.Points) != 3 {
+			t.Fatalf("mode %d has %d points, expected 3", m.ID, len(m.Points))
+		}
+		for j, p := range m.Points {
+			if p.ModeIndex != expIndexes[i][j] {
+				t.Fatalf("mode %d point %d index = %v, expected %v", m.ID, j, p.ModeIndex, expIndexes[i][j])
+			}
+			if p.NaturalFreqHz != expFreqs[i][j] {
+				t.Fatalf("mode %d point %d frequency = %v, expected %v", m.ID, j, p.NaturalFreqHz, expFreqs[i][j])
+			}
+			if j == 0 && p.MAC != 0 {
+				t.Fatalf("mode %d point %d MAC = %v, expected 0 for new track", m.ID, j, p.MAC)
+			}
+			if j > 0 && p.MAC < 0.9 {
+				t.Fatalf("mode %d point %d MAC = %v, expected match with previous point", m.ID, j, p.MAC)
+			}
+		}
+	}
+}
+
+func TestCampbellModeTrackingByFrequency(t *testing.T) {
+
+	// Models at the two conditions have different states, so modes can only
+	// be matched by frequency. Modes at 1.0 and 1.6 Hz are distinct, while
+	// the mode at 3.0 Hz shifts slightly to 3.05 Hz.
+	conditions := []anl.Conditions{{ID: 1}, {ID: 2}}
+	mbcs := []*anl.MBC{
+		{Modes: []*anl.ModeResults{
+			{NaturalFreqHz: 1.0, EigenVector: []complex128{1, 0, 0}},
+			{NaturalFreqHz: 3.0, EigenVector: []complex128{0, 1, 0}},
+		}},
+		{Modes: []*anl.ModeResults{
+			{NaturalFreqHz: 1.6, EigenVector: []complex128{1, 0}},
+			{NaturalFreqHz: 3.05, EigenVector: []complex128{0, 1}},
+		}},
+	}
+
+	cd, err := anl.NewCampbellData(conditions, mbcs, anl.ModeFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	numPoints := map[float64]int{}
+	for _, m := range cd.Modes {
+		numPoints[m.Points[0].NaturalFreqHz] = len(m.Points)
+	}
+	exp := map[float64]int{1.0: 1, 1.6: 1, 3.0: 2}
+	if len(numPoints) != len(exp) {
+		t.Fatalf("got tracks starting at %v, expected %v", numPoints, exp)
+	}
+	for f, n := range exp {
+		if numPoints[f] != n {
+			t.Errorf("track starting at %v Hz has %d points, expected %d", f, numPoints[f], n)
+		}
+	}
+}
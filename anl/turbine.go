@@ -15,13 +15,18 @@ import (
 )
 
 type Turbine struct {
-	ID             int
-	Name           string
-	OperatingPoint Conditions
-	Dir            string
-	ModelPath      string
-	LogPath        string
-	Model          *input.Model
+	ID                   int
+	Name                 string
+	OperatingPoint       Conditions
+	Dir                  string
+	ModelPath            string
+	LogPath              string
+	Model                *input.Model
+	ModalMethod          string      // ModalMethodMBC or ModalMethodFloquet
+	PeriodicityThreshold float64     // Residual periodicity threshold, default if zero
+	Controller           *Controller // Controller for closed loop analysis, if not nil
+	SaveStepMatrices     bool        // Write matrices at each azimuth to the MAT-file
+	NumWorkers           int         // Azimuth steps transformed concurrently by the MBC, one if zero
 }
 
 func NewTurbine(c Conditions, model *input.Model) *Turbine {
@@ -44,6 +49,9 @@ func NewTurbine(c Conditions, model *input.Model) *Turbine {
 	return turb
 }
 
+// Simulate writes the model files and runs OpenFAST to produce the
+// linearization files, sending simulation and linearization progress to
+// statusChan. The caller sends the complete status after post-processing.
 func (turb *Turbine) Simulate(ctx context.Context, execPath string, statusChan chan<- EvalStatus) error {
 
 	// Write model input files
@@ -130,23 +138,35 @@ func (turb *Turbine) Simulate(ctx context.Context, execPath string, statusChan c
 		return fmt.Errorf("run canceled")
 	}
 
-	// Send complete status
-	statusChan <- EvalStatus{
-		ID:       turb.ID,
-		State:    "Complete",
-		Progress: 100,
-	}
-
 	return nil
 }
 
+// MBCPath returns the path to the file containing the MBC results.
+func (turb *Turbine) MBCPath() string {
+	return filepath.Join(turb.Dir, turb.Name+".mbc.json")
+}
+
+// MATPath returns the path to the MAT-file containing the matrix data from
+// the MBC, including the state-space matrices at each azimuth if
+// SaveStepMatrices is set.
+func (turb *Turbine) MATPath() string {
+	return filepath.Join(turb.Dir, turb.Name+".mbc.mat")
+}
+
+// PerformMBC reads the linearization files produced by the turbine, performs
+// the multi-blade coordinate transformation, and writes the results to the
+// files given by MBCPath and MATPath.
 func (turb *Turbine) PerformMBC() (*MBC, error) {
 
-	// Red linearization files produced by this turbine
+	// Read linearization files produced by this turbine
 	linFiles, err := filepath.Glob(filepath.Join(turb.Dir, turb.Name+"*.lin"))
 	if err != nil {
 		return nil, err
 	}
+	if len(linFiles) == 0 {
+		return nil, fmt.Errorf("no linearization files found for '%s' in '%s'",
+			turb.Name, turb.Dir)
+	}
 	linData := make([]*LinData, len(linFiles))
 	for i, f := range linFiles {
 		if linData[i], err = ReadLinData(f); err != nil {
@@ -154,13 +174,55 @@ func (turb *Turbine) PerformMBC() (*MBC, error) {
 		}
 	}
 
+	// Check that all files are from the same linearization
+	if err := CheckLinData(linData); err != nil {
+		return nil, err
+	}
+
+	// Get number of blades from model if available, otherwise it will be
+	// determined from the linearization data
+	numBlades := 0
+	if turb.Model != nil && turb.Model.ElastoDyn != nil {
+		numBlades = turb.Model.ElastoDyn.NumBl
+	}
+
 	// Combine linearization data into matrix data
-	matData, err := collectMatrixData(linData)
+	matData, err := collectMatrixData(linData, numBlades, turb.NumWorkers)
 	if err != nil {
 		return nil, err
 	}
 
-	_ = matData
+	// Check residual periodicity of the MBC state matrices and perform Floquet
+	// analysis if requested, both require states
+	if matData.NumStates > 0 {
+		if matData.Periodicity, err = residualPeriodicity(matData, turb.PeriodicityThreshold); err != nil {
+			return nil, err
+		}
+		if turb.ModalMethod == ModalMethodFloquet {
+			if matData.Floquet, err = floquetAnalysis(matData); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Perform closed loop analysis if controller specified
+	if turb.Controller != nil {
+		if matData.ClosedLoop, err = closedLoopAnalysis(matData, turb.Controller); err != nil {
+			return nil, err
+		}
+	}
+
+	// Save the matrix data next to the linearization files, the matrices at
+	// each azimuth can be several GB for large models so they're optional
+	if err := matData.writeMAT(turb.MATPath(), turb.SaveStepMatrices); err != nil {
+		return nil, err
+	}
+
+	// Create MBC results and save them next to the linearization files
+	mbc := NewMBC(matData)
+	if err := mbc.Write(turb.MBCPath()); err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	return mbc, nil
 }
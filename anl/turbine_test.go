@@ -1,9 +1,13 @@
 package anl_test
 
 import (
+	"fmt"
+	"math"
+	"path/filepath"
 	"testing"
 
 	"github.com/deslaughter/acdc/anl"
+	"gonum.org/v1/gonum/mat"
 )
 
 func TestPerformMBC(t *testing.T) {
@@ -19,3 +23,107 @@ func TestPerformMBC(t *testing.T) {
 	}
 
 }
+
+func TestPerformMBCRotorAcceleration(t *testing.T) {
+
+	// Start-up linearization where the rotor speed increases by 10% between
+	// files, with the acceleration in the generator velocity derivative or
+	// estimated from the rotor-speed sequence without state derivatives
+	for name, withXd := range map[string]bool{"state derivatives": true, "rotor speeds": false} {
+		t.Run(name, func(t *testing.T) {
+			turb := anl.Turbine{Name: "turb_01", Dir: t.TempDir(), SaveStepMatrices: true}
+			for i, ld := range newDrivetrainLinData(0.1, -0.2, -0.01) {
+				ld.SimTime = 10 + 0.5*float64(i)
+				ld.RotorSpeed = 1 + 0.1*float64(i)
+				ld.WindSpeed = 11
+				ld.Xd = nil
+				if withXd {
+					ld.Xd = append([]anl.OperPointData{}, ld.X...)
+					ld.Xd[1].OperPoint = 0.2
+				}
+				path := filepath.Join(turb.Dir, fmt.Sprintf("%s.%d.lin", turb.Name, i+1))
+				if err := ld.WriteLin(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			mbc, err := turb.PerformMBC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(mbc.OmegaDot) != 4 {
+				t.Fatalf("len(OmegaDot) = %d, expected 4", len(mbc.OmegaDot))
+			}
+			for i, v := range mbc.OmegaDot {
+				if math.Abs(v-0.2) > 1e-12 {
+					t.Errorf("OmegaDot[%d] = %v, expected 0.2", i, v)
+				}
+			}
+
+			// Matrices at each azimuth are written to the MAT-file if requested
+			vars := readMAT(t, turb.MATPath())
+			if v := vars["A"]; v == nil || len(v.Dims) != 3 || v.Dims[2] != 4 {
+				t.Errorf("A = %v, expected 4 steps", v)
+			}
+
+			// Only averaged matrices are written unless requested
+			turb.SaveStepMatrices = false
+			if _, err := turb.PerformMBC(); err != nil {
+				t.Fatal(err)
+			}
+			vars = readMAT(t, turb.MATPath())
+			if vars["A"] != nil || vars["RawA"] != nil || vars["AvgA"] == nil {
+				t.Errorf("A = %v, RawA = %v, AvgA = %v, expected only AvgA", vars["A"], vars["RawA"], vars["AvgA"])
+			}
+		})
+	}
+}
+
+func TestPerformMBCWithoutStates(t *testing.T) {
+
+	// Model with only feedthrough from blade pitch to blade root moments
+	turb := anl.Turbine{Name: "turb_01", Dir: t.TempDir(), ModalMethod: anl.ModalMethodFloquet}
+	for i := 0; i < 4; i++ {
+		ld := &anl.LinData{
+			SimTime:    10 + float64(i),
+			Azimuth:    math.Pi / 2 * float64(i),
+			RotorSpeed: 1,
+			NumU:       3,
+			NumY:       3,
+			D:          mat.NewDense(3, 3, []float64{2, 0, 0, 0, 2, 0, 0, 0, 2}),
+		}
+		for b := 1; b <= 3; b++ {
+			ld.U = append(ld.U, anl.OperPointData{RC: b, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d pitch command, rad", b)})
+			ld.Y = append(ld.Y, anl.OperPointData{RC: b, IsRotating: true,
+				Desc: fmt.Sprintf("ED Blade %d root out-of-plane moment, kN-m", b)})
+		}
+		path := filepath.Join(turb.Dir, fmt.Sprintf("%s.%d.lin", turb.Name, i+1))
+		if err := ld.WriteLin(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mbc, err := turb.PerformMBC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mbc.AvgA) != 0 || len(mbc.Modes) != 0 || mbc.Floquet != nil || mbc.Periodicity != nil {
+		t.Errorf("AvgA = %v, %d modes, Floquet = %v, Periodicity = %v, expected none",
+			mbc.AvgA, len(mbc.Modes), mbc.Floquet, mbc.Periodicity)
+	}
+	if len(mbc.AvgD) != 3 {
+		t.Fatalf("AvgD = %v, expected 3 x 3", mbc.AvgD)
+	}
+	for i, row := range mbc.AvgD {
+		for j, v := range row {
+			exp := 0.0
+			if i == j {
+				exp = 2
+			}
+			if math.Abs(v-exp) > 1e-12 {
+				t.Errorf("AvgD(%d,%d) = %v, expected %v", i, j, v, exp)
+			}
+		}
+	}
+}
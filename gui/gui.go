@@ -4,12 +4,15 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
+	"strconv"
 	"time"
 
 	"github.com/deslaughter/acdc/anl"
@@ -47,6 +50,8 @@ func Run(staticFS fs.FS) error {
 		serveWs(hub, w, r)
 	}).Methods("GET")
 	api.HandleFunc("/validate-path", validatePathHandler).Methods("POST")
+	api.HandleFunc("/campbell", getCampbellHandler).Methods("GET")
+	api.HandleFunc("/frequency-response", getFrequencyResponseHandler).Methods("GET")
 
 	// root.PathPrefix("/static/").Handler(http.StripPrefix("/fasted/", http.FileServer(http.FS(staticFS))))
 	staticHandler := func(w http.ResponseWriter, r *http.Request) {
@@ -230,17 +235,169 @@ func (hub *Hub) evaluateStartHandler(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
-	// Wait for evaluations to complete. If error, print
+	// Wait for evaluations to complete. If error, print, otherwise build
+	// Campbell diagram data from the results
 	go func() {
+		defer hub.cancelFunc()
 		if err := g.Wait(); err != nil {
 			fmt.Println(err)
+			return
+		}
+		if err := buildCampbell(); err != nil {
+			fmt.Println(err)
 		}
-		hub.cancelFunc()
 	}()
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// buildCampbell assembles the Campbell diagram data from the evaluation
+// results and saves it in the analysis file.
+func buildCampbell() error {
+
+	analysis, err := anl.Read(AnalysisFile)
+	if err != nil {
+		return fmt.Errorf("error reading '%s': %w", AnalysisFile, err)
+	}
+
+	if err := analysis.BuildCampbell(); err != nil {
+		return err
+	}
+
+	return analysis.Write(AnalysisFile)
+}
+
+func getCampbellHandler(w http.ResponseWriter, r *http.Request) {
+
+	analysis, err := anl.Read(AnalysisFile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading '%s': %s", AnalysisFile, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	if analysis.Campbell == nil {
+		http.Error(w, "Campbell data not available, evaluate analysis", http.StatusNotFound)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(analysis.Campbell)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding Campbell data: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// getFrequencyResponseHandler returns the frequency response between the
+// input and output given by name in the query. Frequencies are given by the
+// 'freq' values (Hz) or 'num' log spaced values from 'min' to 'max' (Hz).
+// Responses are returned for all conditions unless 'condition' is given, and
+// as CSV if 'format' is 'csv', which requires 'condition'.
+func getFrequencyResponseHandler(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	input, output := query.Get("input"), query.Get("output")
+	if input == "" || output == "" {
+		http.Error(w, "input and output are required", http.StatusBadRequest)
+		return
+	}
+
+	// Parse frequency grid
+	freqHz, err := parseFrequencies(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	analysis, err := anl.Read(AnalysisFile)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error reading '%s': %s", AnalysisFile, err),
+			http.StatusInternalServerError)
+		return
+	}
+
+	// Limit to requested condition
+	if s := query.Get("condition"); s != "" {
+		id, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid condition '%s'", s), http.StatusBadRequest)
+			return
+		}
+		conditions := []anl.Conditions{}
+		for _, c := range analysis.Conditions {
+			if c.ID == id {
+				conditions = append(conditions, c)
+			}
+		}
+		if len(conditions) == 0 {
+			http.Error(w, fmt.Sprintf("condition %d not found", id), http.StatusNotFound)
+			return
+		}
+		analysis.Conditions = conditions
+	} else if query.Get("format") == "csv" {
+		http.Error(w, "condition is required for CSV format", http.StatusBadRequest)
+		return
+	}
+
+	// Invalid frequencies and channel names are bad requests, conditions
+	// without MBC results are missing, and other errors are from reading them
+	frs, err := analysis.FrequencyResponses(input, output, freqHz)
+	switch {
+	case errors.Is(err, anl.ErrInvalidFrequency), errors.Is(err, anl.ErrInvalidChannel):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, anl.ErrMBCNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if query.Get("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		if err := frs[0].WriteCSV(w); err != nil {
+			http.Error(w, fmt.Sprintf("error writing frequency response: %s", err), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(frs)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding frequency response: %s", err), http.StatusInternalServerError)
+	}
+}
+
+// parseFrequencies returns the frequencies given as 'freq' values in the
+// query or log spaced between 'min' and 'max' with 'num' values.
+func parseFrequencies(query url.Values) ([]float64, error) {
+
+	if values := query["freq"]; len(values) > 0 {
+		freqHz := make([]float64, len(values))
+		for i, v := range values {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid frequency '%s'", v)
+			}
+			freqHz[i] = f
+		}
+		return freqHz, nil
+	}
+
+	min, err := strconv.ParseFloat(query.Get("min"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid minimum frequency '%s'", query.Get("min"))
+	}
+	max, err := strconv.ParseFloat(query.Get("max"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid maximum frequency '%s'", query.Get("max"))
+	}
+	num, err := strconv.Atoi(query.Get("num"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid number of frequencies '%s'", query.Get("num"))
+	}
+	return anl.LogFrequencies(min, max, num)
+}
+
 func (hub *Hub) evaluateCancelHandler(w http.ResponseWriter, r *http.Request) {
 	hub.cancelFunc()
 	w.WriteHeader(http.StatusNoContent)